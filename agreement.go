@@ -0,0 +1,95 @@
+package conspos
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Agreement reports how the alignments of the strategies agree with each
+// other, to find which strategies differ at inconsistent sites.
+type Agreement struct {
+	// Strategies lists the strategies, starting with the template.
+	Strategies []string
+	// Pairwise holds the agreement of the alignment of Strategies[b] with
+	// the alignment of Strategies[a] at [a][b], averaged over the sites of
+	// Strategies[a]. By default, this is the fraction of the columns whose
+	// alignment pattern is reproduced.
+	Pairwise [][]float64
+	// Agreeing lists the strategies per site in the template alignment
+	// that fully agree with the template, including the template itself.
+	Agreeing [][]string
+}
+
+// StrategyAgreement compares the alignments of the strategies given by the
+// ungapped position matrices, where each matrix is the alignment of the
+// strategy with the same index in names. The first matrix is the template.
+// agreement returns the agreement per site between 0 and 1 of another
+// alignment with the template, like the agreement used for the consistent
+// sites, and a strategy agrees at a site if its agreement is 1.
+func StrategyAgreement(names []string, agreement func(template, other [][]int) []float64, matrices ...[][]int) Agreement {
+	pairwise := make([][]float64, len(matrices))
+	for a := range matrices {
+		pairwise[a] = make([]float64, len(matrices))
+		for b := range matrices {
+			scores := agreement(matrices[a], matrices[b])
+			var total float64
+			for _, score := range scores {
+				total += score
+			}
+			if len(scores) > 0 {
+				pairwise[a][b] = total / float64(len(scores))
+			}
+		}
+	}
+
+	var agreeing [][]string
+	for k, name := range names {
+		for j, score := range agreement(matrices[0], matrices[k]) {
+			if k == 0 {
+				agreeing = append(agreeing, nil)
+			}
+			// The small tolerance absorbs rounding errors of averaged scores.
+			if score >= 1-1e-9 {
+				agreeing[j] = append(agreeing[j], name)
+			}
+		}
+	}
+	return Agreement{Strategies: names, Pairwise: pairwise, Agreeing: agreeing}
+}
+
+// AgreementToBuffer writes the agreement report as tab-separated values to
+// the buffer. The first table is the pairwise agreement between
+// strategies, where each row gives the fraction of columns of the row
+// strategy that are reproduced by the column strategy. The second table
+// lists the strategies that agree and disagree with the template at each
+// site, starting from 1.
+func AgreementToBuffer(a Agreement) bytes.Buffer {
+	var buffer bytes.Buffer
+	buffer.WriteString("# Fraction of columns of the row strategy reproduced by the column strategy\n")
+	buffer.WriteString("strategy\t" + strings.Join(a.Strategies, "\t") + "\n")
+	for i, row := range a.Pairwise {
+		buffer.WriteString(a.Strategies[i])
+		for _, fraction := range row {
+			buffer.WriteString(fmt.Sprintf("\t%.4f", fraction))
+		}
+		buffer.WriteString("\n")
+	}
+
+	buffer.WriteString("\n# Strategies sharing the alignment pattern of the template at each site\n")
+	buffer.WriteString("site\tagreeing\tdisagreeing\n")
+	for j, names := range a.Agreeing {
+		agrees := make(map[string]bool)
+		for _, name := range names {
+			agrees[name] = true
+		}
+		var disagreeing []string
+		for _, name := range a.Strategies {
+			if !agrees[name] {
+				disagreeing = append(disagreeing, name)
+			}
+		}
+		buffer.WriteString(fmt.Sprintf("%d\t%s\t%s\n", j+1, strings.Join(names, ","), strings.Join(disagreeing, ",")))
+	}
+	return buffer
+}
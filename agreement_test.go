@@ -0,0 +1,83 @@
+package conspos_test
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kentwait/conspos"
+)
+
+func TestStrategyAgreement(t *testing.T) {
+	// The second alignment shifts the last residue of the first sequence,
+	// and the third alignment is the same as the template.
+	template := [][]int{
+		{0, 1, 2},
+		{0, 1, 2},
+	}
+	shifted := [][]int{
+		{0, 1, -1, 2},
+		{0, 1, 2, -1},
+	}
+	gapsMatch := func(template, other [][]int) []float64 {
+		scores := conspos.ConsistencyScores(template, other)
+		for j, score := range scores {
+			scores[j] = 2*score - 1
+		}
+		return scores
+	}
+	got := conspos.StrategyAgreement([]string{"t", "s", "u"}, gapsMatch, template, shifted, template)
+
+	wantPairwise := [][]float64{
+		{1, 2.0 / 3, 1},
+		{0.5, 1, 0.5},
+		{1, 2.0 / 3, 1},
+	}
+	if !reflect.DeepEqual(got.Pairwise, wantPairwise) {
+		t.Errorf("Pairwise = %v, want %v", got.Pairwise, wantPairwise)
+	}
+	wantAgreeing := [][]string{{"t", "s", "u"}, {"t", "s", "u"}, {"t", "u"}}
+	if !reflect.DeepEqual(got.Agreeing, wantAgreeing) {
+		t.Errorf("Agreeing = %v, want %v", got.Agreeing, wantAgreeing)
+	}
+}
+
+func TestRunAgreementGolden(t *testing.T) {
+	res, err := conspos.Run(context.Background(), filepath.Join("testdata", "examples", "inconsistent.fa"), fakeOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Agreement.Agreeing) != len(res.ConsistentPos) {
+		t.Fatalf("%d agreement sites for %d sites", len(res.Agreement.Agreeing), len(res.ConsistentPos))
+	}
+	// All strategies agree exactly at the consistent sites.
+	for j, names := range res.Agreement.Agreeing {
+		if all := len(names) == len(res.Strategies); all != res.ConsistentPos[j] {
+			t.Errorf("site %d: agreeing strategies %v but consistent = %v", j+1, names, res.ConsistentPos[j])
+		}
+	}
+	report := conspos.AgreementToBuffer(res.Agreement)
+	checkGolden(t, "inconsistent_agreement.tsv", report.String())
+}
+
+func TestRunAgreementMetric(t *testing.T) {
+	// The agreeing strategies follow the consistent sites of every metric.
+	ignoreGaps := fakeOptions()
+	ignoreGaps.Gaps = conspos.GapsIgnore
+	pairs := fakeOptions()
+	pairs.Metric = conspos.MetricPairs
+	for name, opts := range map[string]conspos.Options{"ignore gaps": ignoreGaps, "pairs": pairs} {
+		t.Run(name, func(t *testing.T) {
+			res, err := conspos.Run(context.Background(), filepath.Join("testdata", "examples", "inconsistent.fa"), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for j, names := range res.Agreement.Agreeing {
+				if all := len(names) == len(res.Strategies); all != res.ConsistentPos[j] {
+					t.Errorf("site %d: agreeing strategies %v but consistent = %v", j+1, names, res.ConsistentPos[j])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package conspos
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	fa "github.com/kentwait/gofasta"
+)
+
+// Aligner aligns a set of sequences using a named alignment strategy.
+type Aligner interface {
+	// Name returns the name of the alignment program.
+	Name() string
+	// DefaultStrategies returns the strategies used when none are specified.
+	DefaultStrategies() []string
+	// Align aligns the FASTA-formatted sequences read from r using the
+	// given strategy and at most the given number of threads, and returns
+	// the resulting alignment.
+	// Aligning stops and returns the error of ctx if ctx is done.
+	Align(ctx context.Context, r io.Reader, strategy string, threads int) (fa.Alignment, error)
+}
+
+// StrategyRegisterer is implemented by aligners that accept custom
+// strategies defined as bundles of command-line arguments.
+type StrategyRegisterer interface {
+	// Register adds a strategy named name that calls the alignment
+	// program using the given arguments.
+	Register(name string, args ...string)
+}
+
+// StrategyChecker is implemented by aligners that can tell which
+// strategies they run, such that unknown strategies are reported before
+// aligning.
+type StrategyChecker interface {
+	// HasStrategy reports whether the aligner can run the strategy.
+	HasStrategy(name string) bool
+	// StrategyNames returns the names of the strategies that the aligner
+	// can run, where numbered strategies are written as a pattern such as
+	// "perturb<seed>".
+	StrategyNames() []string
+}
+
+// StrategyArgs maps the name of an alignment strategy to the command-line
+// arguments passed to an external alignment program.
+type StrategyArgs map[string][]string
+
+// Register adds a strategy named name that calls the alignment program
+// using the given arguments. An existing strategy with the same name is
+// replaced.
+func (s StrategyArgs) Register(name string, args ...string) {
+	s[name] = args
+}
+
+// CheckStrategyName returns an error if name cannot be used as the name of
+// a strategy. Names must not be empty, and must not contain whitespace or
+// path separators because they are part of the paths of saved alignments.
+func CheckStrategyName(name string) error {
+	if len(name) == 0 {
+		return fmt.Errorf("strategy name is empty")
+	}
+	if strings.IndexFunc(name, func(r rune) bool { return unicode.IsSpace(r) || r == '/' || r == '\\' }) >= 0 {
+		return fmt.Errorf("strategy name %q contains whitespace or a path separator", name)
+	}
+	return nil
+}
+
+// names returns the names of the strategies in alphabetical order.
+func (s StrategyArgs) names() []string {
+	var names []string
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// strategyNumber returns the number that ends a strategy name after the
+// given prefix, such as 3 in "perturb3". The number must be written with
+// digits only, without a sign.
+func strategyNumber(strategy, prefix string) (int, bool) {
+	digits := strings.TrimPrefix(strategy, prefix)
+	if len(digits) == len(strategy) || len(digits) == 0 || strings.Trim(digits, "0123456789") != "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(digits)
+	return n, err == nil
+}
+
+// CodonAlign aligns codon sequences by aligning their translated protein
+// sequences using the given aligner and strategy, and then using the
+// protein alignment as a guide to align the codons.
+func CodonAlign(ctx context.Context, a Aligner, c fa.Alignment, strategy string, threads int) (fa.Alignment, error) {
+	// Read protein sequences from Alignment of CodonSequences.
+	// A new reader is created per call because the aligner consumes it.
+	p, err := a.Align(ctx, strings.NewReader(c.ToFasta()), strategy, threads)
+	if err != nil {
+		return nil, err
+	}
+	if len(p) == 0 {
+		return p, nil
+	}
+
+	// The protein alignment must match the codon sequences, otherwise codons
+	// cannot be placed according to the protein alignment.
+	if len(p) != len(c) {
+		return nil, fmt.Errorf("protein alignment has %d sequences, expected %d", len(p), len(c))
+	}
+	for i := range p {
+		residues := len(p[i].Sequence()) - strings.Count(p[i].Sequence(), "-")
+		if residues != len(c[i].Sequence())/3 {
+			return nil, fmt.Errorf("aligned protein sequence %s has %d residues, expected %d", p[i].ID(), residues, len(c[i].Sequence())/3)
+		}
+	}
+
+	// Use protein alignment to offset codons and match alignment.
+	buff := AlignCodonsUsingProtAlignment(c, p)
+	return fa.FastaToAlignment(&buff, true), nil
+}
+
+// reorderAlignment returns the sequences of aln in the same order as the
+// sequences in input. Aligners that output sequences in guide tree order
+// must be reordered so that rows are comparable across strategies.
+//
+// Returns an error if sequence IDs are not unique, because sequences could
+// not be matched, or if the alignment does not have the same sequences as
+// the input.
+func reorderAlignment(aln, input fa.Alignment) (fa.Alignment, error) {
+	if len(aln) == 0 {
+		return aln, nil
+	}
+	index := make(map[string]int)
+	for i, s := range aln {
+		if _, ok := index[s.ID()]; ok {
+			return nil, fmt.Errorf("sequence ID %s is used more than once in the alignment", s.ID())
+		}
+		index[s.ID()] = i
+	}
+	reordered := make(fa.Alignment, 0, len(input))
+	for _, s := range input {
+		i, ok := index[s.ID()]
+		if !ok {
+			return nil, fmt.Errorf("sequence %q is missing from the alignment", s.ID())
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("sequence ID %s is used more than once in the input", s.ID())
+		}
+		reordered = append(reordered, aln[i])
+		// Marks the sequence as used so that a repeated input ID is found.
+		index[s.ID()] = -1
+	}
+	if len(reordered) != len(aln) {
+		return nil, fmt.Errorf("alignment has %d sequences but the input has %d", len(aln), len(input))
+	}
+	return reordered, nil
+}
+
+// execAligner calls an external alignment program with the given arguments
+// and stdin, and returns what it wrote to stdout.
+// The program and any process it started are killed when ctx is done.
+// Returns *AlignerNotFoundError if the program cannot be found, the error
+// of ctx if ctx is done, and *AlignerError with what the program wrote to
+// stderr if it fails.
+func execAligner(ctx context.Context, cmdPath string, stdin io.Reader, args []string) (string, error) {
+	absPath, err := exec.LookPath(cmdPath)
+	if err != nil {
+		return "", &AlignerNotFoundError{Path: cmdPath, Err: err}
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, absPath, args...)
+	cmd.Stdin = stdin
+	cmd.Stderr = &stderr
+	// Alignment programs such as MAFFT are scripts that start other
+	// processes, which must also be killed when ctx is done.
+	killProcessGroup(cmd)
+	// Stops waiting for output held open by orphaned processes.
+	cmd.WaitDelay = time.Second
+	stdout, err := cmd.Output()
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if err != nil {
+		return "", &AlignerError{Path: cmdPath, Stderr: stderr.String(), Err: err}
+	}
+	return string(stdout), nil
+}
@@ -0,0 +1,58 @@
+package conspos
+
+import (
+	"strings"
+	"testing"
+
+	fa "github.com/kentwait/gofasta"
+)
+
+// alignment reads a FASTA alignment from a string.
+func alignment(fasta string) fa.Alignment {
+	return fa.FastaToAlignment(strings.NewReader(fasta), false)
+}
+
+func TestReorderAlignment(t *testing.T) {
+	input := alignment(">a\nACGT\n>b\nACT\n>c\nAGT\n")
+	tests := []struct {
+		name    string
+		aln     string
+		want    []string
+		wantErr string
+	}{
+		{"guide tree order", ">c\nA-GT\n>a\nACGT\n>b\nAC-T\n", []string{"a", "b", "c"}, ""},
+		{"same order", ">a\nACGT\n>b\nAC-T\n>c\nA-GT\n", []string{"a", "b", "c"}, ""},
+		{"missing", ">a\nACGT\n>b\nAC-T\n", nil, "missing"},
+		{"duplicate", ">a\nACGT\n>a\nACGT\n>b\nAC-T\n>c\nA-GT\n", nil, "more than once"},
+		{"extra", ">a\nACGT\n>b\nAC-T\n>c\nA-GT\n>d\nA-GT\n", nil, "has 4 sequences"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reorderAlignment(alignment(tt.aln), input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("reorderAlignment error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, id := range tt.want {
+				if got[i].ID() != id {
+					t.Fatalf("reorderAlignment order = %s, want %v", got.ToFasta(), tt.want)
+				}
+			}
+			if got[1].Sequence() != "AC-T" {
+				t.Errorf("sequence b = %s, want AC-T", got[1].Sequence())
+			}
+		})
+	}
+}
+
+func TestReorderAlignmentDuplicateInput(t *testing.T) {
+	input := alignment(">a\nACGT\n>a\nACGT\n")
+	if _, err := reorderAlignment(alignment(">a\nACGT\n>b\nACGT\n"), input); err == nil {
+		t.Error("reorderAlignment accepted an input with a duplicate ID")
+	}
+}
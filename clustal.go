@@ -0,0 +1,54 @@
+package conspos
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	fa "github.com/kentwait/gofasta"
+)
+
+// ClustalToBuffer writes the template alignment in the Clustal format to
+// the buffer, in blocks of 60 sites. The annotation line below each block
+// marks consistent sites with "*" and leaves inconsistent sites blank, in
+// place of the conservation line written by Clustal. Returns an error if
+// sequence IDs are not unique.
+func ClustalToBuffer(template fa.Alignment, consistentPos []bool) (bytes.Buffer, error) {
+	var buffer bytes.Buffer
+	if err := checkUniqueIDs(template); err != nil {
+		return buffer, err
+	}
+	var width int
+	for _, s := range template {
+		if len(s.ID()) > width {
+			width = len(s.ID())
+		}
+	}
+	// Sequences start 6 spaces after the longest ID, like in Clustal W.
+	width += 6
+	var length int
+	if len(template) > 0 {
+		length = len(template[0].Sequence())
+	}
+
+	buffer.WriteString("CLUSTAL W multiple sequence alignment\n\n")
+	for start := 0; start < length; start += blockWidth {
+		end := start + blockWidth
+		if end > length {
+			end = length
+		}
+		buffer.WriteString("\n")
+		for _, s := range template {
+			buffer.WriteString(fmt.Sprintf("%-*s%s\n", width, s.ID(), s.Sequence()[start:end]))
+		}
+		annotation := make([]byte, end-start)
+		for j := range annotation {
+			annotation[j] = ' '
+			if start+j < len(consistentPos) && consistentPos[start+j] {
+				annotation[j] = '*'
+			}
+		}
+		buffer.WriteString(strings.Repeat(" ", width) + string(annotation) + "\n")
+	}
+	return buffer, nil
+}
@@ -0,0 +1,52 @@
+package conspos_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kentwait/conspos"
+	fa "github.com/kentwait/gofasta"
+)
+
+func TestClustalToBuffer(t *testing.T) {
+	aln := fa.FastaToAlignment(strings.NewReader(">a\n"+strings.Repeat("A", 62)+"\n>bb\n"+strings.Repeat("C", 62)+"\n"), false)
+	consistentPos := make([]bool, 62)
+	for j := range consistentPos {
+		consistentPos[j] = j != 1 && j != 61
+	}
+	buffer, err := conspos.ClustalToBuffer(aln, consistentPos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "CLUSTAL W multiple sequence alignment\n\n" +
+		"\n" +
+		"a       " + strings.Repeat("A", 60) + "\n" +
+		"bb      " + strings.Repeat("C", 60) + "\n" +
+		"        * " + strings.Repeat("*", 58) + "\n" +
+		"\n" +
+		"a       AA\n" +
+		"bb      CC\n" +
+		"        * \n"
+	if got := buffer.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	duplicated := fa.FastaToAlignment(strings.NewReader(">a\nAC\n>a\nAC\n"), false)
+	if _, err := conspos.ClustalToBuffer(duplicated, []bool{true, true}); err == nil {
+		t.Error("Clustal of duplicated IDs did not return an error")
+	}
+}
+
+func TestRunClustalGolden(t *testing.T) {
+	res, err := conspos.Run(context.Background(), filepath.Join("testdata", "examples", "inconsistent.fa"), fakeOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer, err := conspos.ClustalToBuffer(res.TemplateAlignment(), res.ConsistentPos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "inconsistent.clw", buffer.String())
+}
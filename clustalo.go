@@ -0,0 +1,112 @@
+package conspos
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	fa "github.com/kentwait/gofasta"
+)
+
+// ClustalOmega aligns sequences using the Clustal Omega program.
+type ClustalOmega struct {
+	// Path is the path to the Clustal Omega executable.
+	Path string
+	// Strategies maps strategy names to Clustal Omega arguments.
+	// Besides the registered strategies, any registered strategy name
+	// followed by "-iter" and an integer, such as "full-iter2", runs that
+	// strategy with the given number of combined iterations. "iter" and an
+	// integer alone, such as "iter2", runs the default strategy with that
+	// number of iterations.
+	Strategies StrategyArgs
+}
+
+// NewClustalOmega returns a Clustal Omega aligner with the "default"
+// strategy and the "full" strategy, which computes the full distance
+// matrix for the guide tree instead of using mBed, registered.
+func NewClustalOmega(path string) *ClustalOmega {
+	return &ClustalOmega{
+		Path: path,
+		Strategies: StrategyArgs{
+			"default": {},
+			"full":    {"--full", "--full-iter"},
+		},
+	}
+}
+
+// Name returns "clustalo".
+func (c *ClustalOmega) Name() string {
+	return "clustalo"
+}
+
+// DefaultStrategies returns the default and full distance matrix
+// strategies, with and without 2 combined iterations.
+func (c *ClustalOmega) DefaultStrategies() []string {
+	return []string{"default", "full", "iter2", "full-iter2"}
+}
+
+// Register adds a strategy named name that calls Clustal Omega using the
+// given arguments.
+func (c *ClustalOmega) Register(name string, args ...string) {
+	c.Strategies.Register(name, args...)
+}
+
+// HasStrategy reports whether the strategy is registered, or is a
+// registered strategy with a number of iterations.
+func (c *ClustalOmega) HasStrategy(name string) bool {
+	_, ok := c.strategyArgs(name)
+	return ok
+}
+
+// StrategyNames returns the registered strategies, "iter<n>" and
+// "<strategy>-iter<n>".
+func (c *ClustalOmega) StrategyNames() []string {
+	return append(c.Strategies.names(), "iter<n>", "<strategy>-iter<n>")
+}
+
+// strategyArgs returns the Clustal Omega arguments of the given strategy.
+func (c *ClustalOmega) strategyArgs(strategy string) ([]string, bool) {
+	if args, ok := c.Strategies[strategy]; ok {
+		return args, true
+	}
+	base, iter := "default", strategy
+	if i := strings.LastIndex(strategy, "-iter"); i >= 0 {
+		base, iter = strategy[:i], strategy[i+1:]
+	}
+	baseArgs, ok := c.Strategies[base]
+	if !ok {
+		return nil, false
+	}
+	n, ok := strategyNumber(iter, "iter")
+	if !ok {
+		return nil, false
+	}
+	return append(append([]string{}, baseArgs...), "--iter="+strconv.Itoa(n)), true
+}
+
+// Align calls Clustal Omega to align the sequences read from r depending
+// on the specified alignment strategy.
+func (c *ClustalOmega) Align(ctx context.Context, r io.Reader, strategy string, threads int) (fa.Alignment, error) {
+	strategyArgs, ok := c.strategyArgs(strategy)
+	if !ok {
+		return nil, fmt.Errorf("unknown Clustal Omega strategy %q", strategy)
+	}
+	stdout, err := ExecClustalOmega(ctx, c.Path, r, threads, strategyArgs)
+	if err != nil {
+		return nil, err
+	}
+	return fa.FastaToAlignment(strings.NewReader(stdout), false), nil
+}
+
+// ExecClustalOmega calls the Clustal Omega program with the given
+// arguments and number of threads, and using standard input as input.
+// Returns stdout as a string and nil if no errors are encountered.
+// If an error occurs, returns an empty string and the error encountered.
+func ExecClustalOmega(ctx context.Context, clustaloCmd string, stdin io.Reader, threads int, args []string) (string, error) {
+	// Clustal Omega reads the sequences from stdin when the input is "-".
+	// Sequences are kept in input order so that rows are comparable across strategies.
+	args = append([]string{"-i", "-", "--outfmt=fa", "--output-order=input-order", "--threads=" + strconv.Itoa(threads)}, args...)
+	return execAligner(ctx, clustaloCmd, stdin, args)
+}
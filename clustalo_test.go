@@ -0,0 +1,34 @@
+package conspos
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClustalOmegaStrategyArgs(t *testing.T) {
+	c := NewClustalOmega("clustalo")
+	tests := []struct {
+		strategy string
+		want     []string
+		ok       bool
+	}{
+		{"default", []string{}, true},
+		{"full", []string{"--full", "--full-iter"}, true},
+		{"iter2", []string{"--iter=2"}, true},
+		{"default-iter3", []string{"--iter=3"}, true},
+		{"full-iter2", []string{"--full", "--full-iter", "--iter=2"}, true},
+		{"foo-iter2", nil, false},
+		{"-iter2", nil, false},
+		{"iterx", nil, false},
+		{"iter", nil, false},
+		{"full-iter", nil, false},
+		{"iter-2", nil, false},
+		{"full-iter+2", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := c.strategyArgs(tt.strategy)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("strategyArgs(%q) = %q, %v, want %q, %v", tt.strategy, got, ok, tt.want, tt.ok)
+		}
+	}
+}
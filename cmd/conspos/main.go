@@ -0,0 +1,721 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kentwait/conspos"
+)
+
+// Exists returns whether the given file or directory Exists or not,
+// and accompanying errors.
+func Exists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return true, err
+}
+
+// Exit codes of the program
+const (
+	exitOK = iota
+	// exitUsage is returned when flags or arguments are invalid.
+	exitUsage
+	// exitAlignerNotFound is returned when the aligner executable cannot be found.
+	exitAlignerNotFound
+	// exitAlignerFailed is returned when a strategy fails or produces an empty alignment.
+	exitAlignerFailed
+	// exitInvalidInput is returned when an input file cannot be read or aligned.
+	exitInvalidInput
+	// exitTimeout is returned when a strategy exceeds its time limit.
+	exitTimeout
+	// exitInterrupted is returned when the program is interrupted, like
+	// the exit status of a shell for a program stopped by SIGINT.
+	exitInterrupted = 130
+)
+
+// exitCode returns the exit code of the program for an error returned by
+// the pipeline.
+func exitCode(err error) int {
+	var notFound *conspos.AlignerNotFoundError
+	var invalid *conspos.InvalidInputError
+	var timeout *conspos.TimeoutError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.As(err, &notFound):
+		return exitAlignerNotFound
+	case errors.As(err, &invalid):
+		return exitInvalidInput
+	case errors.As(err, &timeout):
+		return exitTimeout
+	default:
+		return exitAlignerFailed
+	}
+}
+
+// markedAlignment returns the marked template alignment of res, with the
+// score sequence if scoreID is not empty, and the support sequence if
+// supportID is not empty and res has bootstrap support.
+func markedAlignment(res conspos.Result, markerID, scoreID, supportID, cMarker, icMarker string) bytes.Buffer {
+	return conspos.TrackedAlignmentToBuffer(res.TemplateAlignment(), res.ConsistentPos, markerID, cMarker, icMarker, markerTracks(res, scoreID, supportID)...)
+}
+
+// markerTracks returns the score track of res if scoreID is not empty, and the
+// support track if supportID is not empty and res has bootstrap support.
+func markerTracks(res conspos.Result, scoreID, supportID string) []conspos.Track {
+	var tracks []conspos.Track
+	if len(scoreID) > 0 {
+		tracks = append(tracks, conspos.Track{ID: scoreID, Scores: res.Scores})
+	}
+	if len(supportID) > 0 && res.Support != nil {
+		tracks = append(tracks, conspos.Track{ID: supportID, Scores: res.Support})
+	}
+	return tracks
+}
+
+// alignmentWriter writes the template alignment of a result in the output
+// format, with the marker and score sequences set by the flags.
+type alignmentWriter struct {
+	format      string
+	interleaved bool
+	// markerID is the name of the marker sequence, to which the quorum and
+	// the template are added if they were set.
+	markerID, scoreID, supportID string
+	cMarker, icMarker            string
+	quorum, template             bool
+	// alignments adds the alignment of each strategy to JSON output.
+	alignments bool
+	// parameters are the run parameters recorded in Stockholm and JSON output.
+	parameters []conspos.Feature
+}
+
+// write returns the template alignment of res in the output format.
+// Returns *conspos.InvalidInputError if the alignment cannot be written in
+// the format.
+func (w alignmentWriter) write(res conspos.Result) (bytes.Buffer, error) {
+	var buffer bytes.Buffer
+	var err error
+	switch w.format {
+	case "phylip", "phylip-strict":
+		buffer, err = conspos.PhylipToBuffer(res.TemplateAlignment(), conspos.PhylipOptions{Strict: w.format == "phylip-strict", Interleaved: w.interleaved})
+	case "nexus":
+		buffer, err = conspos.NexusToBuffer(res.TemplateAlignment(), res.ConsistentPos, conspos.NexusOptions{Interleaved: w.interleaved})
+	case "clustal":
+		buffer, err = conspos.ClustalToBuffer(res.TemplateAlignment(), res.ConsistentPos)
+	case "json":
+		buffer, err = conspos.JSONToBuffer(res, conspos.JSONOptions{Parameters: w.parameters, ConsistentMarker: w.cMarker, InconsistentMarker: w.icMarker, Alignments: w.alignments})
+	case "stockholm":
+		buffer, err = conspos.StockholmToBuffer(res.TemplateAlignment(), res.ConsistentPos, w.cMarker, w.icMarker, w.features(res), markerTracks(res, w.scoreID, w.supportID)...)
+	default:
+		buffer = markedAlignment(res, markerID(w.markerID, res, w.quorum, w.template), w.scoreID, w.supportID, w.cMarker, w.icMarker)
+	}
+	if err != nil {
+		return buffer, &conspos.InvalidInputError{InputPath: res.InputPath, Err: err}
+	}
+	return buffer, nil
+}
+
+// features returns the strategies compared in res, the template, and the
+// number or weight of strategies that must agree, followed by the run
+// parameters.
+func (w alignmentWriter) features(res conspos.Result) []conspos.Feature {
+	agreement := conspos.Feature{Tag: "min_agreement", Text: fmt.Sprintf("%d/%d", res.MinAgreement, len(res.Strategies))}
+	if res.MinWeight > 0 {
+		agreement = conspos.Feature{Tag: "min_weight", Text: fmt.Sprintf("%g/%g", res.MinWeight, res.TotalWeight)}
+	}
+	features := []conspos.Feature{
+		{Tag: "strategies", Text: strings.Join(res.Strategies, ",")},
+		{Tag: "template", Text: res.Template},
+		agreement,
+	}
+	return append(features, w.parameters...)
+}
+
+// writeSidecar saves the marker sequence of res, followed by the score and
+// support sequences, in FASTA format to basePath+".marker.fa".
+func (w alignmentWriter) writeSidecar(res conspos.Result, basePath string) error {
+	sidecar := conspos.TrackedAlignmentToBuffer(nil, res.ConsistentPos, markerID(w.markerID, res, w.quorum, w.template), w.cMarker, w.icMarker, markerTracks(res, w.scoreID, w.supportID)...)
+	return ioutil.WriteFile(basePath+".marker.fa", sidecar.Bytes(), 0644)
+}
+
+// markerID returns the header of the marker sequence. If a template was
+// chosen, the strategy of the template alignment is added to the
+// description. If a quorum or a minimum weight was set, the number or the
+// weight of strategies that must agree is added as well.
+func markerID(id string, res conspos.Result, quorum, template bool) string {
+	fields := []string{id}
+	if template {
+		fields = append(fields, "template="+res.Template)
+	}
+	if res.MinWeight > 0 {
+		fields = append(fields, fmt.Sprintf("min_weight=%g/%g", res.MinWeight, res.TotalWeight))
+	} else if quorum {
+		fields = append(fields, fmt.Sprintf("min_agreement=%d/%d", res.MinAgreement, len(res.Strategies)))
+	}
+	return strings.Join(fields, " ")
+}
+
+// writeResidueScores saves the residue scores of res in FASTA format to
+// basePath+".scores.fa" and as tab-separated values to
+// basePath+".scores.tsv". If res has bootstrap support, the residue support
+// is saved in the same way to basePath+".support.fa" and
+// basePath+".support.tsv".
+func writeResidueScores(res conspos.Result, basePath string) error {
+	if err := writeResidueTrack(res, res.ResidueScores, basePath+".scores"); err != nil {
+		return err
+	}
+	if res.ResidueSupport != nil {
+		return writeResidueTrack(res, res.ResidueSupport, basePath+".support")
+	}
+	return nil
+}
+
+// writeResidueTrack saves scores per residue of the template alignment of
+// res in FASTA format to prefix+".fa" and as tab-separated values to
+// prefix+".tsv".
+func writeResidueTrack(res conspos.Result, scores [][]float64, prefix string) error {
+	fasta := conspos.ResidueScoresToBuffer(res.TemplateAlignment(), scores)
+	if err := ioutil.WriteFile(prefix+".fa", fasta.Bytes(), 0644); err != nil {
+		return err
+	}
+	tsv := conspos.ResidueScoresToTSVBuffer(res.TemplateAlignment(), scores)
+	return ioutil.WriteFile(prefix+".tsv", tsv.Bytes(), 0644)
+}
+
+// writeAgreement saves the agreement report of res as tab-separated
+// values to basePath+".agreement.tsv".
+func writeAgreement(res conspos.Result, basePath string) error {
+	report := conspos.AgreementToBuffer(res.Agreement)
+	return ioutil.WriteFile(basePath+".agreement.tsv", report.Bytes(), 0644)
+}
+
+// strategyDefs collects the values of a repeatable flag defining custom
+// strategies as "name=arguments".
+type strategyDefs []string
+
+func (d *strategyDefs) String() string {
+	return strings.Join(*d, " ")
+}
+
+func (d *strategyDefs) Set(value string) error {
+	nameArgs := strings.SplitN(value, "=", 2)
+	if len(nameArgs) != 2 {
+		return fmt.Errorf("expected name=arguments")
+	}
+	if err := conspos.CheckStrategyName(nameArgs[0]); err != nil {
+		return err
+	}
+	*d = append(*d, value)
+	return nil
+}
+
+func main() {
+	toUpper := false
+	toLower := false
+
+	// # Program arguments
+	// ConsPos uses flag arguments to set run parameters.
+	// There are several types of flags based on what parameter they set.
+	// - ConsPos flags set general parameters regarding the ConsPos program itself.
+	// - Codon-specific flags set parameters for when dealing with codon alignments.
+	// - Batch flags indicate that the analysis is a batch analysis of many multiple sequence alignments. Arguments under this category sets file input and output handling for files.
+	// - Aligner flags select the alignment program that ConsPos uses to generate the multiple sequence alignments.
+	// - MAFFT-related flags are arguments intended for the MAFFT alignment program.
+	// - MUSCLE-related flags are arguments intended for the MUSCLE alignment program.
+	// - Clustal Omega-related flags are arguments intended for the Clustal Omega alignment program.
+
+	// Invalid flags exit with exitUsage rather than the status used by the flag package.
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+	// ConsPos flags
+	markerIDPtr := flags.String("marker_id", "marker", "Name of marker sequence.")
+	scoreIDPtr := flags.String("score_id", "", "Name of the score sequence written after the marker sequence. Each site is the fraction of strategies that agree with the template from 0 to 9. Not written if empty.")
+	cMarkerPtr := flags.String("consistent_marker", "C", "Character to indicate a site is consistent across all alignment strategies.")
+	icMarkerPtr := flags.String("inconsistent_marker", "N", "Character to indicate a site is inconsistent in at least one alignment strategy.")
+	formatPtr := flags.String("format", "fasta", "Format of the output alignment. The marker sequence is only written in FASTA, and can be saved separately using -marker_sidecar. \"phylip\" writes relaxed PHYLIP with full sequence IDs, and \"phylip-strict\" truncates IDs to 10 characters. \"nexus\" defines the consistent and inconsistent sites as character sets. \"stockholm\" writes the marker, score and support sequences as #=GC annotations, and the strategies and parameters as #=GF annotations. \"clustal\" marks consistent sites with * in the annotation line below each block. \"json\" writes the result, including the consistency of each site and the parameters of the run, as a JSON object on a single line. {fasta|phylip|phylip-strict|nexus|stockholm|clustal|json}")
+	jsonAlignmentsPtr := flags.Bool("json_alignments", false, "Add the alignment of each strategy to JSON output.")
+	interleavedPtr := flags.Bool("interleaved", false, "Write PHYLIP and NEXUS output in blocks of 60 sites instead of one line per sequence.")
+	markerSidecarPtr := flags.Bool("marker_sidecar", false, "Save the marker sequence, followed by the score and support sequences, in FASTA format (.marker.fa). Saved next to the input file, or next to the output file in batch mode.")
+	agreementPtr := flags.Bool("agreement", false, "Save a report of the agreement between strategies as tab-separated values (.agreement.tsv): the fraction of columns of each strategy reproduced by each other strategy, and the strategies that share the alignment pattern of the template at each site. Saved next to the input file, or next to the output file in batch mode.")
+	residueScoresPtr := flags.Bool("residue_scores", false, "Save the consistency score of each residue as digits from 0 to 9 in FASTA format (.scores.fa) and as tab-separated values (.scores.tsv). Saved next to the input file, or next to the output file in batch mode. Residue support is saved in the same way (.support.fa and .support.tsv) if -bootstrap is used.")
+	headsOrTailsPtr := flags.Bool("heads_or_tails", false, "Also align the reversed sequences using each strategy, and compare these alignments with the others. The template is unchanged.")
+	bootstrapPtr := flags.Int("bootstrap", 0, "Number of replicate alignments that follow guide trees built from bootstrapped sites of the template alignment. Used to compute the support of each site. No replicates if 0.")
+	bootstrapStrategyPtr := flags.String("bootstrap_strategy", "", "Strategy used to align the bootstrap replicates. Uses the template strategy if empty.")
+	bootstrapSeedPtr := flags.Int64("bootstrap_seed", 1, "Seed of the random sampling of sites for bootstrap guide trees.")
+	supportIDPtr := flags.String("support_id", "support", "Name of the support sequence written after the marker sequence if -bootstrap is used. Each site is the fraction of replicates that reproduce it from 0 to 9. Not written if empty.")
+	metricPtr := flags.String("metric", "column", "Measure of consistency. \"column\" compares the alignment pattern of whole columns, and \"pairs\" compares pairs of aligned residues. {column|pairs}")
+	gapsPtr := flags.String("gaps", "match", "Treatment of gaps when comparing the alignment pattern of a site. \"match\" requires gaps to be at the same sites, and \"ignore\" only compares the residues of the site. {match|ignore}")
+	maxGapFractionPtr := flags.Float64("max_gap_fraction", 0, "Mark sites where the fraction of sequences with a gap is greater than this value as inconsistent. Not applied if 0.")
+	weightsPtr := flags.String("weights", "", "Weights of the alignments of strategies as comma-separated strategy=weight pairs, such as einsi=2,ginsi=0.5. Strategies that are not listed weigh 1. Requires a minimum weight set by -min_weight or the config file. Overrides the weights in the config file.")
+	minWeightPtr := flags.Float64("min_weight", 0, "Minimum summed weight of the strategies, including the template, that must agree for a site to be consistent. Replaces -min_agreement. Overrides the minimum weight in the config file. Not used if 0.")
+	minAgreementPtr := flags.String("min_agreement", "", "Minimum number (such as 3) or fraction (such as 0.6 or 60%) of strategies that must agree for a site to be consistent. All strategies must agree if empty.")
+	gapCharPtr := flags.String("gapchar", "-", "Character in the alignment used to represent a gap.")
+	changeCasePtr := flags.String("change_case", "upper", "Change the case of the sequences. {upper|lower|no}")
+	timeoutPtr := flags.Duration("timeout", 0, "Time limit of each alignment strategy, such as 30m or 2h. No limit if 0.")
+	threadsPtr := flags.Int("threads", 0, "Number of threads shared by all strategies running at the same time. Uses all CPUs but one if 0, and all CPUs if -1.")
+	concurrencyPtr := flags.Int("concurrency", 0, "Maximum number of strategies that run at the same time. Runs all strategies at the same time if 0, and one strategy at a time if 1.")
+	fileTimeoutPtr := flags.Duration("file_timeout", 0, "Time limit of all alignment strategies of one file. No limit if 0.")
+
+	// Codon-specific flags
+	isCodonPtr := flags.Bool("codon", false, "Create a codon-based alignment.")
+
+	// Batch flags
+	isBatchPtr := flags.String("batch", "", "Run in batch mode which reads files found in the specified folder.")
+	outDirPtr := flags.String("outdir", "", "Output directory where alignments will be saved. Used in conjunction with -batch.")
+	inSuffixPtr := flags.String("input_suffix", ".fa", "Only files ending with this suffix will be processed. Used in conjunction with -batch.")
+	outSuffixPtr := flags.String("output_suffix", ".aln", "Suffix to be appended to the end of the filename of resulting alignments. Used in conjunction with -batch.")
+
+	// Aligner flags
+	alignerPtr := flags.String("aligner", "mafft", "Alignment program used to generate the alignments. {mafft|muscle|clustalo|native}")
+	templatePtr := flags.String("template", "", "Strategy whose alignment is used as the template and written to the output, or \"best\" to use the alignment that agrees the most with the other strategies. The chosen strategy is written in the header of the marker sequence. Uses the last strategy if empty.")
+	strategiesPtr := flags.String("strategies", "", "Comma-separated list of alignment strategies to compare. The last strategy is used as the template. Uses the default strategies of the aligner if empty.")
+	var customStrategies strategyDefs
+	flags.Var(&customStrategies, "define_strategy", "Define a custom strategy as name=\"arguments\" that can be listed in -strategies. Can be used multiple times.")
+	configPathPtr := flags.String("config", "", "Path to a JSON configuration file listing the strategies to compare. Overridden by -strategies.")
+
+	// MAFFT-related flags
+	maxIterPtr := flags.Int("maxiterate", 1, "Maximum number of iterative refinement that MAFFT will perform.")
+	saveTempAlnPtr := flags.Bool("save_temp_alignments", false, "Save the alignment generated by each strategy.")
+	mafftPathPtr := flags.String("mafft_path", "mafft", "Path to MAFFT executable. If MAFFT is registered in $PATH, you can use \"mafft\".")
+
+	// MUSCLE-related flags
+	musclePathPtr := flags.String("muscle_path", "muscle", "Path to MUSCLE 5 executable. If MUSCLE is registered in $PATH, you can use \"muscle\". Used in conjunction with -aligner muscle.")
+
+	// Clustal Omega-related flags
+	clustaloPathPtr := flags.String("clustalo_path", "clustalo", "Path to Clustal Omega executable. If Clustal Omega is registered in $PATH, you can use \"clustalo\". Used in conjunction with -aligner clustalo.")
+
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		// The flag package has already reported the error and printed the usage.
+		if err == flag.ErrHelp {
+			os.Exit(exitOK)
+		}
+		os.Exit(exitUsage)
+	}
+
+	// Checks if values of arguments are valid.
+
+	// Creates the aligner and validates the supplied path for its executable.
+	// Raises an error and exits if the path does not exist.
+	var aligner conspos.Aligner
+	switch *alignerPtr {
+	case "mafft":
+		if _, lookErr := exec.LookPath(*mafftPathPtr); lookErr != nil {
+			os.Stderr.WriteString("Error: Invalid MAFFT path. Make sure that the MAFFT executable is installed and is accessible at the path specified in -mafft_path.\n")
+			os.Exit(exitAlignerNotFound)
+		}
+		aligner = conspos.NewMafft(*mafftPathPtr, *maxIterPtr)
+	case "muscle":
+		if _, lookErr := exec.LookPath(*musclePathPtr); lookErr != nil {
+			os.Stderr.WriteString("Error: Invalid MUSCLE path. Make sure that the MUSCLE executable is installed and is accessible at the path specified in -muscle_path.\n")
+			os.Exit(exitAlignerNotFound)
+		}
+		aligner = conspos.NewMuscle(*musclePathPtr)
+	case "clustalo":
+		if _, lookErr := exec.LookPath(*clustaloPathPtr); lookErr != nil {
+			os.Stderr.WriteString("Error: Invalid Clustal Omega path. Make sure that the Clustal Omega executable is installed and is accessible at the path specified in -clustalo_path.\n")
+			os.Exit(exitAlignerNotFound)
+		}
+		aligner = conspos.NewClustalOmega(*clustaloPathPtr)
+	case "native":
+		// The native aligner is built in and does not need an executable.
+		aligner = conspos.NewNative()
+	default:
+		os.Stderr.WriteString("Error: Invalid -aligner value {mafft|muscle|clustalo|native}.\n")
+		os.Exit(exitUsage)
+	}
+
+	// Custom strategies are registered in the aligner if it accepts arguments.
+	// Strategies are read from the config file, and -strategies takes precedence.
+	var strategies []string
+	weights := make(conspos.Weights)
+	var minWeight float64
+	if len(*configPathPtr) > 0 {
+		config, err := conspos.ReadConfig(*configPathPtr)
+		if err != nil {
+			os.Stderr.WriteString(fmt.Sprintf("Error: %s\n", err))
+			os.Exit(exitUsage)
+		}
+		if strategies, err = config.Apply(aligner); err != nil {
+			os.Stderr.WriteString(fmt.Sprintf("Error: %s\n", err))
+			os.Exit(exitUsage)
+		}
+		weights, minWeight = config.Weights(), config.MinWeight
+	}
+	for _, def := range customStrategies {
+		registerer, ok := aligner.(conspos.StrategyRegisterer)
+		if !ok {
+			os.Stderr.WriteString(fmt.Sprintf("Error: -define_strategy cannot be used with -aligner %s.\n", *alignerPtr))
+			os.Exit(exitUsage)
+		}
+		nameArgs := strings.SplitN(def, "=", 2)
+		registerer.Register(nameArgs[0], strings.Fields(nameArgs[1])...)
+	}
+	if len(*strategiesPtr) > 0 {
+		strategies = strings.Split(*strategiesPtr, ",")
+	}
+	// Checks that strategies are not repeated.
+	seenStrategies := make(map[string]bool)
+	for _, strategy := range strategies {
+		if len(strategy) == 0 || seenStrategies[strategy] {
+			os.Stderr.WriteString("Error: Invalid -strategies value. Strategies must not be empty or repeated.\n")
+			os.Exit(exitUsage)
+		}
+		seenStrategies[strategy] = true
+	}
+	// Checks that the aligner knows the strategies, so that a misspelled strategy is reported before aligning.
+	if checker, ok := aligner.(conspos.StrategyChecker); ok {
+		listed := strategies
+		if len(*bootstrapStrategyPtr) > 0 {
+			listed = append(append([]string{}, strategies...), *bootstrapStrategyPtr)
+		}
+		for _, strategy := range listed {
+			// Reversed strategies run the strategy on reversed sequences.
+			if !checker.HasStrategy(strings.TrimPrefix(strategy, conspos.ReversePrefix)) {
+				os.Stderr.WriteString(fmt.Sprintf("Error: Unknown strategy %s. The strategies of -aligner %s are %s.\n", strategy, *alignerPtr, strings.Join(checker.StrategyNames(), ",")))
+				os.Exit(exitUsage)
+			}
+		}
+	}
+
+	// Checks that the template is one of the strategies, including the reversed strategies of -heads_or_tails.
+	if len(*templatePtr) > 0 && *templatePtr != conspos.TemplateBest {
+		listed := strategies
+		if len(listed) == 0 {
+			listed = aligner.DefaultStrategies()
+		}
+		found := false
+		for _, strategy := range listed {
+			if *templatePtr == strategy || (*headsOrTailsPtr && *templatePtr == conspos.ReversePrefix+strategy) {
+				found = true
+			}
+		}
+		if !found {
+			os.Stderr.WriteString(fmt.Sprintf("Error: Invalid -template value. %s is not one of the strategies %s.\n", *templatePtr, strings.Join(listed, ",")))
+			os.Exit(exitUsage)
+		}
+	}
+
+	switch *formatPtr {
+	case "fasta", "phylip", "phylip-strict", "nexus", "stockholm", "clustal", "json":
+	default:
+		os.Stderr.WriteString("Error: Invalid -format value {fasta|phylip|phylip-strict|nexus|stockholm|clustal|json}.\n")
+		os.Exit(exitUsage)
+	}
+	writer := alignmentWriter{
+		format:      *formatPtr,
+		interleaved: *interleavedPtr,
+		markerID:    *markerIDPtr,
+		scoreID:     *scoreIDPtr,
+		supportID:   *supportIDPtr,
+		cMarker:     *cMarkerPtr,
+		icMarker:    *icMarkerPtr,
+		quorum:      len(*minAgreementPtr) > 0,
+		template:    len(*templatePtr) > 0,
+		alignments:  *jsonAlignmentsPtr,
+	}
+
+	metric := conspos.Metric(*metricPtr)
+	if metric != conspos.MetricColumn && metric != conspos.MetricPairs {
+		os.Stderr.WriteString("Error: Invalid -metric value {column|pairs}.\n")
+		os.Exit(exitUsage)
+	}
+
+	gaps := conspos.GapPolicy(*gapsPtr)
+	if gaps != conspos.GapsMatch && gaps != conspos.GapsIgnore {
+		os.Stderr.WriteString("Error: Invalid -gaps value {match|ignore}.\n")
+		os.Exit(exitUsage)
+	}
+	if *maxGapFractionPtr < 0 || *maxGapFractionPtr > 1 {
+		os.Stderr.WriteString("Error: Invalid -max_gap_fraction value. Must be between 0 and 1.\n")
+		os.Exit(exitUsage)
+	}
+
+	if _, ok := aligner.(conspos.TreeAligner); *bootstrapPtr > 0 && !ok {
+		os.Stderr.WriteString(fmt.Sprintf("Error: -bootstrap cannot be used with -aligner %s.\n", *alignerPtr))
+		os.Exit(exitUsage)
+	}
+
+	// The strategies that are run, including the reversed strategies of -heads_or_tails.
+	runStrategies := strategies
+	if len(runStrategies) == 0 {
+		runStrategies = aligner.DefaultStrategies()
+	}
+	if *headsOrTailsPtr {
+		runStrategies = conspos.WithReversed(runStrategies)
+	}
+
+	// Parses the weights and checks that they are used, that they are of strategies that are run,
+	// and that the minimum weight can be reached by the strategies.
+	if len(*weightsPtr) > 0 {
+		flagWeights, err := conspos.ParseWeights(*weightsPtr)
+		if err != nil {
+			os.Stderr.WriteString(fmt.Sprintf("Error: Invalid -weights value: %s\n", err))
+			os.Exit(exitUsage)
+		}
+		for strategy, weight := range flagWeights {
+			weights[strategy] = weight
+		}
+	}
+	if *minWeightPtr < 0 {
+		os.Stderr.WriteString("Error: Invalid -min_weight value. Must not be negative.\n")
+		os.Exit(exitUsage)
+	} else if *minWeightPtr > 0 {
+		minWeight = *minWeightPtr
+	}
+	if len(weights) > 0 && minWeight == 0 {
+		os.Stderr.WriteString("Error: Weights set by -weights or the config file are only used with a minimum weight set by -min_weight or the config file.\n")
+		os.Exit(exitUsage)
+	}
+	if minWeight > 0 {
+		if len(*minAgreementPtr) > 0 {
+			os.Stderr.WriteString("Error: -min_agreement cannot be used with a minimum weight set by -min_weight or the config file.\n")
+			os.Exit(exitUsage)
+		}
+		weighted := runStrategies
+		if err := weights.Check(weighted); err != nil {
+			os.Stderr.WriteString(fmt.Sprintf("Error: Invalid weights: %s.\n", err))
+			os.Exit(exitUsage)
+		}
+		if totalWeight := weights.Total(weighted); minWeight > totalWeight {
+			os.Stderr.WriteString(fmt.Sprintf("Error: Invalid -min_weight value. Strategies weighing %g cannot reach a weight of %g.\n", totalWeight, minWeight))
+			os.Exit(exitUsage)
+		}
+	}
+
+	// Parses the quorum and checks that it can be reached by the strategies.
+	var minAgreement conspos.Quorum
+	if len(*minAgreementPtr) > 0 {
+		var err error
+		if minAgreement, err = conspos.ParseQuorum(*minAgreementPtr); err != nil {
+			os.Stderr.WriteString(fmt.Sprintf("Error: Invalid -min_agreement value: %s\n", err))
+			os.Exit(exitUsage)
+		}
+		numStrategies := len(runStrategies)
+		if minAgreement.Count > numStrategies {
+			os.Stderr.WriteString(fmt.Sprintf("Error: Invalid -min_agreement value. %d strategies cannot reach a quorum of %d.\n", numStrategies, minAgreement.Count))
+			os.Exit(exitUsage)
+		}
+	}
+
+	// Converts case change choices to boolean variables.
+	switch *changeCasePtr {
+	case "lower":
+		toLower = true
+	case "upper":
+		toUpper = true
+	case "no":
+	default:
+		os.Stderr.WriteString("Error: Invalid -change_case value {upper|lower|no}.\n")
+		os.Exit(exitUsage)
+	}
+
+	// The pipeline treats sequences as single character sites or codons (3 characters per site) depending on -codon.
+	// The gapchar argument depends on this.
+	// For example, if codons, the gapchar should be 3 characters long, and only a single character if not.
+	if *isCodonPtr {
+		// TODO: gapchar check should be length, not char matching
+		if *gapCharPtr == "-" {
+			*gapCharPtr = "---"
+		}
+	}
+	bootstrap := conspos.Bootstrap{
+		Replicates: *bootstrapPtr,
+		Strategy:   *bootstrapStrategyPtr,
+		Seed:       *bootstrapSeedPtr,
+	}
+	opts := conspos.Options{
+		Aligner:            aligner,
+		Strategies:         strategies,
+		Template:           *templatePtr,
+		HeadsOrTails:       *headsOrTailsPtr,
+		Bootstrap:          bootstrap,
+		MafftPath:          *mafftPathPtr,
+		GapChar:            *gapCharPtr,
+		Iterations:         *maxIterPtr,
+		Codon:              *isCodonPtr,
+		ToUpper:            toUpper,
+		ToLower:            toLower,
+		SaveTempAlignments: *saveTempAlnPtr,
+		Metric:             metric,
+		Gaps:               gaps,
+		MaxGapFraction:     *maxGapFractionPtr,
+		MinAgreement:       minAgreement,
+		Weights:            weights,
+		MinWeight:          minWeight,
+		ResidueScores:      *residueScoresPtr,
+		Threads:            *threadsPtr,
+		Concurrency:        *concurrencyPtr,
+		Timeout:            *timeoutPtr,
+		FileTimeout:        *fileTimeoutPtr,
+		Progress:           os.Stderr,
+	}
+
+	// Run parameters recorded in Stockholm and JSON output.
+	writer.parameters = []conspos.Feature{
+		{Tag: "aligner", Text: *alignerPtr},
+		{Tag: "metric", Text: string(metric)},
+		{Tag: "gaps", Text: string(gaps)},
+	}
+	if *maxGapFractionPtr > 0 {
+		writer.parameters = append(writer.parameters, conspos.Feature{Tag: "max_gap_fraction", Text: strconv.FormatFloat(*maxGapFractionPtr, 'g', -1, 64)})
+	}
+	if *bootstrapPtr > 0 {
+		writer.parameters = append(writer.parameters, conspos.Feature{Tag: "bootstrap", Text: strconv.Itoa(*bootstrapPtr)})
+	}
+	if *isCodonPtr {
+		writer.parameters = append(writer.parameters, conspos.Feature{Tag: "codon", Text: "true"})
+	}
+
+	// Interrupting the program stops the running aligner.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// The program is two modes: single file and batch mode.
+	// Because arguments are mode-dependent, the validity of arguments are checked depending whether or not -batch is empty (single file) or not (batch mode).
+	if len(*isBatchPtr) == 0 {
+		// Single file mode expects a single positional argument (FASTA file path).
+		// Checks whether there is at least one positional argument present.
+		// Raises an error and exists if no positional arguments are present, or when more than one is given.
+		args := flags.Args()
+		if len(args) == 0 {
+			os.Stderr.WriteString("Error: Missing path to FASTA file.\n")
+			os.Exit(exitUsage)
+		} else if len(args) > 1 {
+			os.Stderr.WriteString("Error: More than 1 positional argument passed.\n")
+			os.Exit(exitUsage)
+		}
+		// Given that there is only one positional argument supplied, checks whether a file exists at that path.
+		// This does not check whether the file is a FASTA file though.
+		if doesExist, _ := Exists(args[0]); doesExist == false {
+			os.Stderr.WriteString("Error: file does not exist.\n")
+			os.Exit(exitUsage)
+		}
+
+		res, err := conspos.Run(ctx, args[0], opts)
+		if err != nil {
+			os.Stderr.WriteString(fmt.Sprintf("Error: %s\n", err))
+			os.Exit(exitCode(err))
+		}
+		buffer, err := writer.write(res)
+		if err != nil {
+			os.Stderr.WriteString(fmt.Sprintf("Error: %s\n", err))
+			os.Exit(exitCode(err))
+		}
+		fmt.Print(buffer.String())
+		if *markerSidecarPtr {
+			if err := writer.writeSidecar(res, args[0]); err != nil {
+				os.Stderr.WriteString(fmt.Sprintf("Error: %s\n", err))
+				os.Exit(exitUsage)
+			}
+		}
+		if *residueScoresPtr {
+			if err := writeResidueScores(res, args[0]); err != nil {
+				os.Stderr.WriteString(fmt.Sprintf("Error: %s\n", err))
+				os.Exit(exitUsage)
+			}
+		}
+		if *agreementPtr {
+			if err := writeAgreement(res, args[0]); err != nil {
+				os.Stderr.WriteString(fmt.Sprintf("Error: %s\n", err))
+				os.Exit(exitUsage)
+			}
+		}
+		// TODO: clear buffer after writing to stdout?
+
+	} else {
+		// Batch mode is activated when the value of -batch is not empty.
+		// The -batch value is the directory containing the FASTA files to work on.
+		// Checks whether the path exists but it does not check if the path is a file or a directory.
+		if doesExist, _ := Exists(*isBatchPtr); doesExist == false {
+			os.Stderr.WriteString("Error: Specified directory containing FASTA files does not exist.\n")
+			os.Exit(exitUsage)
+		}
+
+		// In batch mode, -outdir must be specified to tell ConsPos where to save the aligned files.
+		// Check is -outdir has any value.
+		if len(*outDirPtr) == 0 {
+			os.Stderr.WriteString("Error: Missing output directory.\nUse -outdir to specify an output directory where alignments will be saved.\n")
+			os.Exit(exitUsage)
+		}
+		// Checks if the specified output directory path exists.
+		// This does not check if the path is to a directory or a file.
+		// This does not check if the path (assuming its a directory) is empty.
+		if doesExist, _ := Exists(*outDirPtr); doesExist == false {
+			os.Stderr.WriteString("Error: Specified output directory does not exist.\n")
+			os.Exit(exitUsage)
+		}
+
+		// Read all fasta files in directory matching suffix
+		files, err := filepath.Glob(*isBatchPtr + "/*" + *inSuffixPtr)
+		if err != nil {
+			panic(err)
+		}
+
+		// A file that fails is reported and skipped so that the rest of the batch is still processed.
+		// The exit code is set by the first failure, using the same codes as in single file mode.
+		var batchCode int
+		fail := func(err error, code int) {
+			os.Stderr.WriteString(fmt.Sprintf("Error: %s\n", err))
+			if batchCode == exitOK {
+				batchCode = code
+			}
+		}
+		for _, f := range files {
+			res, err := conspos.Run(ctx, f, opts)
+			if err != nil {
+				// Every file would fail if the aligner cannot be found or the program was interrupted
+				var notFound *conspos.AlignerNotFoundError
+				if errors.As(err, &notFound) || ctx.Err() != nil {
+					os.Stderr.WriteString(fmt.Sprintf("Error: %s\n", err))
+					os.Exit(exitCode(err))
+				}
+				fail(err, exitCode(err))
+				continue
+			}
+			buffer, err := writer.write(res)
+			if err != nil {
+				fail(err, exitCode(err))
+				continue
+			}
+			outputPath := *outDirPtr + "/" + filepath.Base(f) + *outSuffixPtr
+			if err := ioutil.WriteFile(outputPath, buffer.Bytes(), 0644); err != nil {
+				fail(err, exitUsage)
+				continue
+			}
+
+			if *markerSidecarPtr {
+				if err := writer.writeSidecar(res, outputPath); err != nil {
+					fail(err, exitUsage)
+				}
+			}
+			if *residueScoresPtr {
+				if err := writeResidueScores(res, outputPath); err != nil {
+					fail(err, exitUsage)
+				}
+			}
+			if *agreementPtr {
+				if err := writeAgreement(res, outputPath); err != nil {
+					fail(err, exitUsage)
+				}
+			}
+		}
+		os.Exit(batchCode)
+	}
+}
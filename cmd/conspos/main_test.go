@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kentwait/conspos"
+	"github.com/kentwait/conspos/internal/fakealigner"
+)
+
+// mainEnv is set when the test binary should run the conspos program.
+const mainEnv = "CONSPOS_TEST_MAIN"
+
+// The test binary doubles as the conspos program and as a fake MAFFT
+// executable.
+func TestMain(m *testing.M) {
+	if len(os.Getenv(mainEnv)) > 0 {
+		// Unset so that the fake MAFFT called by the program does not run the program again.
+		os.Unsetenv(mainEnv)
+		main()
+		os.Exit(exitOK)
+	}
+	fakealigner.RunMafftIfRequested()
+	os.Exit(m.Run())
+}
+
+var testdata = filepath.Join("..", "..", "testdata")
+
+// runConspos runs the conspos program with the given arguments using the
+// canned alignments in testdata, and returns its stdout and exit code.
+func runConspos(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(executable, append([]string{"-mafft_path", executable}, args...)...)
+	cmd.Env = append(os.Environ(), mainEnv+"=1", fakealigner.DirEnv+"="+filepath.Join(testdata, "alignments"))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return stdout.String(), exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return stdout.String(), exitOK
+}
+
+// checkGolden compares got to the golden file testdata/golden/<name>.aln.
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join(testdata, "golden", name+".aln")
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s: output differs from %s\ngot:\n%s\nwant:\n%s", name, path, got, want)
+	}
+}
+
+func TestSingleFile(t *testing.T) {
+	for _, name := range []string{"consistent", "inconsistent"} {
+		t.Run(name, func(t *testing.T) {
+			stdout, code := runConspos(t, filepath.Join(testdata, "examples", name+".fa"))
+			if code != exitOK {
+				t.Fatalf("exit code = %d, want %d", code, exitOK)
+			}
+			checkGolden(t, name, stdout)
+		})
+	}
+}
+
+func TestCodon(t *testing.T) {
+	stdout, code := runConspos(t, "-codon", filepath.Join(testdata, "codon", "codon.fa"))
+	if code != exitOK {
+		t.Fatalf("exit code = %d, want %d", code, exitOK)
+	}
+	checkGolden(t, "codon", stdout)
+}
+
+func TestBatch(t *testing.T) {
+	outDir := t.TempDir()
+	_, code := runConspos(t, "-batch", filepath.Join(testdata, "examples"), "-outdir", outDir)
+	if code != exitOK {
+		t.Fatalf("exit code = %d, want %d", code, exitOK)
+	}
+	for _, name := range []string{"consistent", "inconsistent"} {
+		output, err := ioutil.ReadFile(filepath.Join(outDir, name+".fa.aln"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkGolden(t, name, string(output))
+	}
+}
+
+func TestBatchUnwritableOutput(t *testing.T) {
+	outDir := t.TempDir()
+	// A directory in place of the output file cannot be written.
+	if err := os.Mkdir(filepath.Join(outDir, "consistent.fa.aln"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	_, code := runConspos(t, "-batch", filepath.Join(testdata, "examples"), "-outdir", outDir)
+	if code != exitUsage {
+		t.Errorf("exit code = %d, want %d", code, exitUsage)
+	}
+	// The rest of the batch is still processed.
+	output, err := ioutil.ReadFile(filepath.Join(outDir, "inconsistent.fa.aln"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "inconsistent", string(output))
+}
+
+func TestExitCodeInterrupted(t *testing.T) {
+	err := &conspos.StrategyError{Strategy: "einsi", InputPath: "input.fa", Err: context.Canceled}
+	if code := exitCode(err); code != exitInterrupted {
+		t.Errorf("exitCode(%v) = %d, want %d", err, code, exitInterrupted)
+	}
+}
+
+func TestMinAgreement(t *testing.T) {
+	// L-INSI is the template, and G-INSI agrees with it where E-INSI does not.
+	stdout, code := runConspos(t, "-min_agreement", "2", "-strategies", "einsi,ginsi,linsi", filepath.Join(testdata, "examples", "inconsistent.fa"))
+	if code != exitOK {
+		t.Fatalf("exit code = %d, want %d", code, exitOK)
+	}
+	lines := strings.SplitN(stdout, "\n", 3)
+	if lines[0] != ">marker min_agreement=2/3" {
+		t.Errorf("marker header = %q, want the quorum used", lines[0])
+	}
+	if strings.Contains(lines[1], "N") {
+		t.Errorf("marker = %s, want all sites consistent with a quorum of 2", lines[1])
+	}
+}
+
+func TestMinWeight(t *testing.T) {
+	// L-INSI is the template, and G-INSI agrees with it where the lighter E-INSI does not.
+	config := filepath.Join(t.TempDir(), "config.json")
+	content := `{"strategies": [{"name": "einsi", "weight": 0.5}, {"name": "ginsi"}, {"name": "linsi"}], "min_weight": 2}`
+	if err := ioutil.WriteFile(config, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout, code := runConspos(t, "-config", config, filepath.Join(testdata, "examples", "inconsistent.fa"))
+	if code != exitOK {
+		t.Fatalf("exit code = %d, want %d", code, exitOK)
+	}
+	lines := strings.SplitN(stdout, "\n", 3)
+	if lines[0] != ">marker min_weight=2/2.5" {
+		t.Errorf("marker header = %q, want the minimum weight used", lines[0])
+	}
+	if strings.Contains(lines[1], "N") {
+		t.Errorf("marker = %s, want all sites consistent with a minimum weight of 2", lines[1])
+	}
+
+	// Weighing E-INSI more than G-INSI and L-INSI together makes it required.
+	stdout, code = runConspos(t, "-config", config, "-weights", "einsi=3", "-min_weight", "4", filepath.Join(testdata, "examples", "inconsistent.fa"))
+	if code != exitOK {
+		t.Fatalf("exit code = %d, want %d", code, exitOK)
+	}
+	lines = strings.SplitN(stdout, "\n", 3)
+	if lines[0] != ">marker min_weight=4/5" || !strings.Contains(lines[1], "N") {
+		t.Errorf("marker = %q, %s, want inconsistent sites with a minimum weight of 4/5", lines[0], lines[1])
+	}
+
+	// The weight of E-INSI in the config would be ignored if it is not run.
+	if _, code = runConspos(t, "-config", config, "-strategies", "ginsi,linsi", filepath.Join(testdata, "examples", "inconsistent.fa")); code != exitUsage {
+		t.Errorf("exit code = %d, want %d for a weighted strategy that is not run", code, exitUsage)
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	stdout, code := runConspos(t, "-template", "best", filepath.Join(testdata, "examples", "inconsistent.fa"))
+	if code != exitOK {
+		t.Fatalf("exit code = %d, want %d", code, exitOK)
+	}
+	lines := strings.SplitN(stdout, "\n", 3)
+	if lines[0] != ">marker template=linsi" {
+		t.Errorf("marker header = %q, want the chosen template", lines[0])
+	}
+}
+
+func TestFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		args   []string
+		golden string
+	}{
+		{"phylip", []string{"-interleaved"}, "inconsistent.phy"},
+		{"nexus", []string{"-interleaved"}, "inconsistent.nex"},
+		{"stockholm", []string{"-score_id", "score"}, "inconsistent.sto"},
+		{"clustal", nil, "inconsistent.clw"},
+		{"json", nil, "inconsistent.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			outDir := t.TempDir()
+			args := append([]string{"-format", tt.format, "-marker_sidecar", "-batch", filepath.Join(testdata, "examples"), "-outdir", outDir}, tt.args...)
+			_, code := runConspos(t, args...)
+			if code != exitOK {
+				t.Fatalf("exit code = %d, want %d", code, exitOK)
+			}
+			path := filepath.Join(outDir, "inconsistent.fa.aln")
+			output, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := ioutil.ReadFile(filepath.Join(testdata, "golden", tt.golden))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(output) != string(want) {
+				t.Errorf("%s differs from the golden file\ngot:\n%s\nwant:\n%s", path, output, want)
+			}
+
+			// The sidecar starts with the marker sequence of the FASTA output.
+			sidecar, err := ioutil.ReadFile(path + ".marker.fa")
+			if err != nil {
+				t.Fatal(err)
+			}
+			marked, err := ioutil.ReadFile(filepath.Join(testdata, "golden", "inconsistent.aln"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if markerLines := strings.SplitAfterN(string(marked), "\n", 3); !strings.HasPrefix(string(sidecar), markerLines[0]+markerLines[1]) {
+				t.Errorf("sidecar = %q, want the marker sequence %q", sidecar, markerLines[0]+markerLines[1])
+			}
+		})
+	}
+}
+
+func TestResidueScores(t *testing.T) {
+	outDir := t.TempDir()
+	_, code := runConspos(t, "-residue_scores", "-batch", filepath.Join(testdata, "examples"), "-outdir", outDir)
+	if code != exitOK {
+		t.Fatalf("exit code = %d, want %d", code, exitOK)
+	}
+	for _, suffix := range []string{".fa", ".tsv"} {
+		path := filepath.Join(outDir, "inconsistent.fa.aln.scores"+suffix)
+		output, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := ioutil.ReadFile(filepath.Join(testdata, "golden", "inconsistent_residues"+suffix))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(output) != string(want) {
+			t.Errorf("%s differs from the golden file\ngot:\n%s\nwant:\n%s", path, output, want)
+		}
+	}
+}
+
+func TestAgreement(t *testing.T) {
+	outDir := t.TempDir()
+	_, code := runConspos(t, "-agreement", "-batch", filepath.Join(testdata, "examples"), "-outdir", outDir)
+	if code != exitOK {
+		t.Fatalf("exit code = %d, want %d", code, exitOK)
+	}
+	path := filepath.Join(outDir, "inconsistent.fa.aln.agreement.tsv")
+	output, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(filepath.Join(testdata, "golden", "inconsistent_agreement.tsv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(output) != string(want) {
+		t.Errorf("%s differs from the golden file\ngot:\n%s\nwant:\n%s", path, output, want)
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	stdout, code := runConspos(t, "-bootstrap", "2", filepath.Join(testdata, "examples", "consistent.fa"))
+	if code != exitOK {
+		t.Fatalf("exit code = %d, want %d", code, exitOK)
+	}
+	lines := strings.Split(stdout, "\n")
+	if lines[2] != ">support" || strings.Trim(lines[3], "9") != "" {
+		t.Errorf("output does not have full support after the marker:\n%s", stdout)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"missing input", nil, exitUsage},
+		{"unknown flag", []string{"-no_such_flag", filepath.Join(testdata, "examples", "consistent.fa")}, exitUsage},
+		{"malformed flag", []string{"-threads", "many", filepath.Join(testdata, "examples", "consistent.fa")}, exitUsage},
+		{"unreachable min_agreement", []string{"-min_agreement", "4", filepath.Join(testdata, "examples", "consistent.fa")}, exitUsage},
+		{"unreachable min_agreement with listed reverse strategy", []string{"-heads_or_tails", "-strategies", "einsi,reverse-einsi,linsi", "-min_agreement", "5", filepath.Join(testdata, "examples", "consistent.fa")}, exitUsage},
+		{"unreachable min_weight", []string{"-weights", "einsi=2", "-min_weight", "4.5", filepath.Join(testdata, "examples", "consistent.fa")}, exitUsage},
+		{"min_weight with min_agreement", []string{"-min_weight", "2", "-min_agreement", "2", filepath.Join(testdata, "examples", "consistent.fa")}, exitUsage},
+		{"invalid weights", []string{"-weights", "einsi=-1", "-min_weight", "2", filepath.Join(testdata, "examples", "consistent.fa")}, exitUsage},
+		{"weights without min_weight", []string{"-weights", "einsi=2", filepath.Join(testdata, "examples", "consistent.fa")}, exitUsage},
+		{"weights of unknown strategy", []string{"-weights", "einis=2", "-min_weight", "2", filepath.Join(testdata, "examples", "consistent.fa")}, exitUsage},
+		{"unknown strategy", []string{"-strategies", "einis,linsi", filepath.Join(testdata, "examples", "consistent.fa")}, exitUsage},
+		{"unknown reversed strategy", []string{"-strategies", "reverse-einis,linsi", filepath.Join(testdata, "examples", "consistent.fa")}, exitUsage},
+		{"unknown native strategy", []string{"-aligner", "native", "-strategies", "globl", filepath.Join(testdata, "examples", "consistent.fa")}, exitUsage},
+		{"unknown bootstrap strategy", []string{"-bootstrap", "2", "-bootstrap_strategy", "einis", filepath.Join(testdata, "examples", "consistent.fa")}, exitUsage},
+		{"unnamed defined strategy", []string{"-define_strategy", "=--auto", filepath.Join(testdata, "examples", "consistent.fa")}, exitUsage},
+		{"defined strategy name with path separator", []string{"-define_strategy", "a/b=--auto", filepath.Join(testdata, "examples", "consistent.fa")}, exitUsage},
+		{"defined strategy name with whitespace", []string{"-define_strategy", "a b=--auto", filepath.Join(testdata, "examples", "consistent.fa")}, exitUsage},
+		{"unknown template", []string{"-template", "fftns2", filepath.Join(testdata, "examples", "consistent.fa")}, exitUsage},
+		{"invalid format", []string{"-format", "genbank", filepath.Join(testdata, "examples", "consistent.fa")}, exitUsage},
+		{"bootstrap without guide trees", []string{"-aligner", "clustalo", "-clustalo_path", os.Args[0], "-bootstrap", "2", filepath.Join(testdata, "examples", "consistent.fa")}, exitUsage},
+		{"invalid change_case", []string{"-change_case", "title", filepath.Join(testdata, "examples", "consistent.fa")}, exitUsage},
+		{"aligner not found", []string{"-mafft_path", filepath.Join(testdata, "missing"), filepath.Join(testdata, "examples", "consistent.fa")}, exitAlignerNotFound},
+		{"aligner failed", []string{"-strategies", "auto", filepath.Join(testdata, "examples", "consistent.fa")}, exitAlignerFailed},
+		{"invalid codon input", []string{"-codon", filepath.Join(testdata, "examples", "consistent.fa")}, exitInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, code := runConspos(t, tt.args...); code != tt.want {
+				t.Errorf("exit code = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package conspos
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Config is the format of a configuration file listing the strategies to
+// run. For example:
+//
+//	{
+//	  "strategies": [
+//	    {"name": "ginsi"},
+//	    {"name": "fftns2"},
+//	    {"name": "ep0", "args": ["--genafpair", "--ep", "0"], "weight": 2}
+//	  ],
+//	  "min_weight": 3
+//	}
+type Config struct {
+	Strategies []StrategyConfig `json:"strategies"`
+	// MinWeight is the summed weight of the strategies that must agree at
+	// a site for it to be consistent. Not used if zero.
+	MinWeight float64 `json:"min_weight,omitempty"`
+}
+
+// StrategyConfig defines a strategy in a Config.
+type StrategyConfig struct {
+	// Name is the name of the strategy.
+	Name string `json:"name"`
+	// Args are the command-line arguments passed to the aligner.
+	// If empty, Name must be a strategy already known to the aligner.
+	Args []string `json:"args,omitempty"`
+	// Weight is the weight of the alignment of the strategy. If zero, the
+	// strategy weighs 1.
+	Weight float64 `json:"weight,omitempty"`
+}
+
+// ReadConfig reads a JSON-formatted Config from the file at path.
+func ReadConfig(path string) (Config, error) {
+	var c Config
+	f, err := os.Open(path)
+	if err != nil {
+		return c, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return c, fmt.Errorf("invalid config file %s: %s", path, err)
+	}
+	return c, nil
+}
+
+// Apply registers the strategies of the config that define arguments in
+// the aligner, and returns the names of all strategies in order.
+func (c Config) Apply(a Aligner) ([]string, error) {
+	var strategies []string
+	seen := make(map[string]bool)
+	for _, s := range c.Strategies {
+		if err := CheckStrategyName(s.Name); err != nil {
+			return nil, err
+		}
+		if s.Weight < 0 {
+			return nil, fmt.Errorf("strategy %q has a negative weight", s.Name)
+		}
+		if seen[s.Name] {
+			return nil, fmt.Errorf("strategy %q is listed more than once", s.Name)
+		}
+		seen[s.Name] = true
+
+		if len(s.Args) > 0 {
+			r, ok := a.(StrategyRegisterer)
+			if !ok {
+				return nil, fmt.Errorf("%s does not accept strategies defined by arguments", a.Name())
+			}
+			r.Register(s.Name, s.Args...)
+		}
+		strategies = append(strategies, s.Name)
+	}
+	return strategies, nil
+}
+
+// Weights returns the weights of the strategies of the config that set a
+// weight.
+func (c Config) Weights() Weights {
+	w := make(Weights)
+	for _, s := range c.Strategies {
+		if s.Weight > 0 {
+			w[s.Name] = s.Weight
+		}
+	}
+	return w
+}
@@ -0,0 +1,344 @@
+// Package conspos computes the consistency of alignment patterns across
+// multiple sequence alignments of the same set of sequences generated
+// using different alignment strategies.
+//
+// Sites whose alignment pattern is reproduced by every strategy are
+// called "consistent", while sites that exhibit mixed patterns are
+// called "inconsistent".
+package conspos
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+
+	fa "github.com/kentwait/gofasta"
+)
+
+// Metric is the measure of consistency used to score each site.
+type Metric string
+
+const (
+	// MetricColumn scores a site by the fraction of alignments that
+	// reproduce the alignment pattern of the whole column of the template.
+	MetricColumn Metric = "column"
+	// MetricPairs scores a site by the fraction of pairs of residues
+	// aligned in the template column that are also aligned in the other
+	// alignments.
+	MetricPairs Metric = "pairs"
+)
+
+// GapPolicy is the treatment of gaps when comparing the alignment pattern
+// of a site of the template with the other alignments.
+type GapPolicy string
+
+const (
+	// GapsMatch requires the sequences with a gap at a site of the template
+	// to also have a gap at the site in the other alignments.
+	GapsMatch GapPolicy = "match"
+	// GapsIgnore ignores the sequences with a gap at a site of the
+	// template, and only requires the residues of the site to be aligned
+	// together in the other alignments.
+	GapsIgnore GapPolicy = "ignore"
+)
+
+// Options sets the parameters of a consistency pipeline run.
+type Options struct {
+	// Aligner generates the alignment of each strategy. If nil, MAFFT is
+	// called using MafftPath and Iterations.
+	Aligner Aligner
+	// Strategies lists the alignment strategies to run. If empty, the
+	// default strategies of the aligner are used. The alignment of the
+	// last strategy is used as the template unless Template is set.
+	// Strategies starting with ReversePrefix align the reversed sequences.
+	Strategies []string
+	// Template is the strategy whose alignment is used as the template,
+	// or TemplateBest to use the alignment that agrees the most with the
+	// others. If empty, the last strategy is used.
+	Template string
+	// HeadsOrTails adds the reversed strategy of each strategy, such that
+	// each alignment is also compared with the alignment of the reversed
+	// sequences. The template is unchanged.
+	HeadsOrTails bool
+	// MafftPath is the path to the MAFFT executable. If MAFFT is
+	// registered in $PATH, "mafft" can be used.
+	MafftPath string
+	// GapChar is the string used to represent a gap in the alignment.
+	// For codon alignments this should be 3 characters long.
+	GapChar string
+	// Iterations is the maximum number of iterative refinement that
+	// MAFFT will perform.
+	Iterations int
+	// Codon indicates that the sequences should be aligned as codons.
+	Codon bool
+	// ToUpper and ToLower change the case of the template alignment.
+	ToUpper bool
+	ToLower bool
+	// SaveTempAlignments saves the alignment of each strategy next to
+	// the input file.
+	SaveTempAlignments bool
+	// Metric is the measure of consistency used to score sites. If empty,
+	// MetricColumn is used.
+	Metric Metric
+	// Gaps is the treatment of gaps when comparing alignment patterns using
+	// MetricColumn. If empty, GapsMatch is used. MetricPairs only compares
+	// residues and always ignores gaps.
+	Gaps GapPolicy
+	// MaxGapFraction marks the sites of the template where the fraction of
+	// sequences with a gap is greater than MaxGapFraction as inconsistent.
+	// Not applied if zero.
+	MaxGapFraction float64
+	// MinAgreement is the number of alignments that must reproduce the
+	// alignment pattern of a site for it to be consistent. If zero, all
+	// alignments must agree. Using MetricPairs, the residue pairs of a
+	// consistent site must be reproduced on average by as many alignments.
+	MinAgreement Quorum
+	// Weights sets the weight of the alignment of each strategy. Only used
+	// if MinWeight is set.
+	Weights Weights
+	// MinWeight is the summed weight of the alignments, including the
+	// template, that must agree with the template at a site for it to be
+	// consistent. Each alignment counts in proportion to its agreement
+	// with the template given by the metric. Replaces MinAgreement if
+	// greater than zero.
+	MinWeight float64
+	// ResidueScores computes the consistency score of each residue of the
+	// template alignment.
+	ResidueScores bool
+	// Bootstrap sets the replicate alignments used to compute the support
+	// of each site.
+	Bootstrap Bootstrap
+	// Threads is the number of threads shared by all running strategies.
+	// If 0, all CPUs but one are used. If -1, all CPUs are used.
+	Threads int
+	// Concurrency is the maximum number of strategies that run at the same
+	// time. If 0, all strategies run at the same time.
+	Concurrency int
+	// Timeout is the time limit of each strategy. There is no limit if zero.
+	Timeout time.Duration
+	// FileTimeout is the time limit of all strategies of one file. There is
+	// no limit if zero.
+	FileTimeout time.Duration
+	// Progress receives progress messages. Nothing is written if nil.
+	Progress io.Writer
+}
+
+// DefaultOptions returns the options used by the conspos command-line
+// program when no flags are given.
+func DefaultOptions() Options {
+	return Options{
+		MafftPath:  "mafft",
+		GapChar:    "-",
+		Iterations: 1,
+		ToUpper:    true,
+	}
+}
+
+// aligner returns the Aligner used to generate the alignments. Any
+// strategy of the aligner can be run on reversed sequences using
+// ReversePrefix.
+func (o Options) aligner() Aligner {
+	if o.Aligner != nil {
+		return reversingAligner{o.Aligner}
+	}
+	return reversingAligner{NewMafft(o.MafftPath, o.Iterations)}
+}
+
+// strategies returns the alignment strategies to run using aligner.
+func (o Options) strategies(aligner Aligner) []string {
+	strategies := o.Strategies
+	if len(strategies) == 0 {
+		strategies = aligner.DefaultStrategies()
+	}
+	if o.HeadsOrTails {
+		return WithReversed(strategies)
+	}
+	return strategies
+}
+
+// scores returns the function that computes the consistency scores of the
+// metric.
+func (o Options) scores(codon bool) func(...[][]int) []float64 {
+	switch {
+	case o.Metric == MetricPairs && codon:
+		return ResiduePairCodonScores
+	case o.Metric == MetricPairs:
+		return ResiduePairScores
+	case o.Gaps == GapsIgnore && codon:
+		return ConsistencyCodonScoresIgnoringGaps
+	case o.Gaps == GapsIgnore:
+		return ConsistencyScoresIgnoringGaps
+	case codon:
+		return ConsistencyCodonScores
+	}
+	return ConsistencyScores
+}
+
+// residueScores returns the function that computes the consistency score
+// of each residue.
+func (o Options) residueScores(codon bool) func(...[][]int) [][]float64 {
+	if codon {
+		return ResidueCodonScores
+	}
+	return ResidueScores
+}
+
+// agreement returns the function that computes the agreement per site
+// between 0 and 1 of another alignment with the template, given by the
+// metric.
+func (o Options) agreement(codon bool) func([][]int, [][]int) []float64 {
+	scores := o.scores(codon)
+	return func(template, other [][]int) []float64 {
+		agreement := scores(template, other)
+		if o.Metric != MetricPairs {
+			// Column scores of 2 alignments count the template itself.
+			for j, score := range agreement {
+				agreement[j] = 2*score - 1
+			}
+		}
+		return agreement
+	}
+}
+
+// treeAligner returns the aligner as a TreeAligner if it can align using
+// a given guide tree.
+func (o Options) treeAligner() (TreeAligner, bool) {
+	if o.Aligner == nil {
+		return NewMafft(o.MafftPath, o.Iterations), true
+	}
+	a, ok := o.Aligner.(TreeAligner)
+	return a, ok
+}
+
+// threads returns the thread budget shared by all running strategies.
+func (o Options) threads() int {
+	switch {
+	case o.Threads == -1:
+		return runtime.NumCPU()
+	case o.Threads <= 0 && runtime.NumCPU() > 1:
+		return runtime.NumCPU() - 1
+	case o.Threads <= 0:
+		return 1
+	}
+	return o.Threads
+}
+
+// concurrency returns the number of strategies that run at the same time
+// out of n strategies.
+func (o Options) concurrency(n int) int {
+	if o.Concurrency > 0 && o.Concurrency < n {
+		return o.Concurrency
+	}
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// fileContext returns a context that is done after FileTimeout.
+func (o Options) fileContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.FileTimeout > 0 {
+		return context.WithTimeout(ctx, o.FileTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// progressMu serializes progress messages, which are written by the
+// goroutines of each strategy.
+var progressMu sync.Mutex
+
+// progress writes a progress message if a Progress writer is set. It is
+// safe to call from several goroutines.
+func (o Options) progress(s string) {
+	if o.Progress != nil {
+		progressMu.Lock()
+		defer progressMu.Unlock()
+		io.WriteString(o.Progress, s)
+	}
+}
+
+// failed ends the progress message of a failed run and returns err.
+func (o Options) failed(err error) (Result, error) {
+	o.progress(" Failed.\n")
+	return Result{}, err
+}
+
+// Result holds the alignments generated by each strategy and the
+// consistency of each site in the template alignment.
+type Result struct {
+	// InputPath is the path of the FASTA file that was aligned.
+	InputPath string
+	// Strategies lists the alignment strategies in the order they were run.
+	Strategies []string
+	// Alignments maps each strategy to its resulting alignment.
+	Alignments map[string]fa.Alignment
+	// ConsistentPos indicates per site in the template alignment whether
+	// its alignment pattern is reproduced by at least MinAgreement
+	// strategies, or by strategies weighing at least MinWeight.
+	ConsistentPos []bool
+	// MinAgreement is the number of alignments, including the template,
+	// that reproduce the alignment pattern of each consistent site.
+	MinAgreement int
+	// MinWeight is the summed weight of the alignments that agree with
+	// the template at each consistent site. It is zero unless
+	// Options.MinWeight is set.
+	MinWeight float64
+	// TotalWeight is the summed weight of all alignments. It is zero
+	// unless Options.MinWeight is set.
+	TotalWeight float64
+	// Weight is the summed weight per site in the template alignment of
+	// the alignments that agree with the template. It is nil unless
+	// Options.MinWeight is set.
+	Weight []float64
+	// Scores is the consistency score per site in the template alignment
+	// given by the metric. Using MetricColumn, it is the fraction of
+	// strategies that share the alignment pattern of the template. Using
+	// MetricPairs, it is the fraction of aligned residue pairs of the
+	// template that are reproduced by the other strategies. Sites where
+	// all strategies agree have a score of 1.
+	Scores []float64
+	// ResidueScores is the consistency score per residue of each sequence
+	// in the template alignment, as returned by ResidueScores. Gaps have a
+	// score of -1. It is nil unless Options.ResidueScores is set.
+	ResidueScores [][]float64
+	// Support is the fraction of bootstrap replicates per site in the
+	// template alignment that reproduce the site, measured using the
+	// metric. It is nil unless Options.Bootstrap sets replicates.
+	Support []float64
+	// ResidueSupport is the fraction of residues aligned with each residue
+	// of the template that stay aligned with it in the bootstrap
+	// replicates. Gaps have a support of -1. It is nil unless
+	// Options.Bootstrap sets replicates.
+	ResidueSupport [][]float64
+	// Agreement compares the alignments of the strategies with each other
+	// and lists the strategies that share the alignment pattern of each
+	// site in the template alignment.
+	Agreement Agreement
+	// Template is the strategy whose alignment is used as the template.
+	Template string
+}
+
+// TemplateAlignment returns the alignment used as the template.
+func (r Result) TemplateAlignment() fa.Alignment {
+	return r.Alignments[r.Template]
+}
+
+// Run aligns the sequences in the FASTA file at inputPath and computes
+// the consistent sites. Sequences are aligned as codons if opts.Codon is
+// true.
+//
+// Errors are one of *InvalidInputError if the input cannot be read,
+// *EmptyAlignmentError if a strategy produced no alignment, and
+// *StrategyError wrapping the error of the aligner if a strategy failed,
+// such as *AlignerNotFoundError or *AlignerError for external programs.
+// *TimeoutError is returned if a strategy exceeds its time limit.
+// Cancelling ctx stops the running strategy and returns a *StrategyError
+// wrapping the error of ctx.
+func Run(ctx context.Context, inputPath string, opts Options) (Result, error) {
+	if opts.Codon {
+		return ConsistentCodonAlnPipeline(ctx, inputPath, opts)
+	}
+	return ConsistentAlnPipeline(ctx, inputPath, opts)
+}
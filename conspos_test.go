@@ -0,0 +1,410 @@
+package conspos_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kentwait/conspos"
+	"github.com/kentwait/conspos/internal/fakealigner"
+	fa "github.com/kentwait/gofasta"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// The test binary doubles as a fake MAFFT executable.
+func TestMain(m *testing.M) {
+	fakealigner.RunMafftIfRequested()
+	os.Exit(m.Run())
+}
+
+// fakeOptions returns the default options using the canned alignments in
+// testdata.
+func fakeOptions() conspos.Options {
+	opts := conspos.DefaultOptions()
+	opts.Aligner = &fakealigner.Aligner{Dir: filepath.Join("testdata", "alignments")}
+	return opts
+}
+
+// marked returns the marked alignment of res as written by the conspos
+// program.
+func marked(res conspos.Result) string {
+	buffer := conspos.MarkedAlignmentToBuffer(res.TemplateAlignment(), res.ConsistentPos, "marker", "C", "N")
+	return buffer.String()
+}
+
+// checkGolden compares got to the golden file testdata/golden/<name>,
+// or updates the file if -update is set.
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name)
+	if *update {
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s: output differs from %s\ngot:\n%s\nwant:\n%s", name, path, got, want)
+	}
+}
+
+func TestRunGolden(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		codon bool
+	}{
+		{"consistent", "testdata/examples/consistent.fa", false},
+		{"inconsistent", "testdata/examples/inconsistent.fa", false},
+		{"codon", "testdata/codon/codon.fa", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := fakeOptions()
+			opts.Codon = tt.codon
+			if tt.codon {
+				opts.GapChar = "---"
+			}
+			res, err := conspos.Run(context.Background(), tt.input, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Template != "einsi" {
+				t.Errorf("template = %q, want einsi", res.Template)
+			}
+			checkGolden(t, tt.name+".aln", marked(res))
+		})
+	}
+}
+
+func TestRunFakeMafftExecutable(t *testing.T) {
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(fakealigner.DirEnv, filepath.Join("testdata", "alignments"))
+
+	for _, name := range []string{"consistent", "inconsistent"} {
+		t.Run(name, func(t *testing.T) {
+			opts := conspos.DefaultOptions()
+			opts.MafftPath = executable
+			res, err := conspos.Run(context.Background(), filepath.Join("testdata", "examples", name+".fa"), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, name+".aln", marked(res))
+		})
+	}
+}
+
+func TestRunAlignerError(t *testing.T) {
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The fake MAFFT fails because there are no canned alignments for the input.
+	t.Setenv(fakealigner.DirEnv, t.TempDir())
+
+	opts := conspos.DefaultOptions()
+	opts.MafftPath = executable
+	_, err = conspos.Run(context.Background(), filepath.Join("testdata", "examples", "consistent.fa"), opts)
+	var strategyErr *conspos.StrategyError
+	var alignerErr *conspos.AlignerError
+	if !errors.As(err, &strategyErr) || !errors.As(err, &alignerErr) {
+		t.Fatalf("Run error = %v, want *StrategyError wrapping *AlignerError", err)
+	}
+	if !strings.Contains(alignerErr.Stderr, "no canned") {
+		t.Errorf("AlignerError.Stderr = %q, want the stderr of the aligner", alignerErr.Stderr)
+	}
+}
+
+// cancelAligner cancels the run after its first alignment.
+type cancelAligner struct {
+	*fakealigner.Aligner
+	cancel context.CancelFunc
+}
+
+func (a cancelAligner) Align(ctx context.Context, r io.Reader, strategy string, threads int) (fa.Alignment, error) {
+	defer a.cancel()
+	return a.Aligner.Align(ctx, r, strategy, threads)
+}
+
+func TestRunCancelledBetweenStrategies(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opts := fakeOptions()
+	opts.Aligner = cancelAligner{opts.Aligner.(*fakealigner.Aligner), cancel}
+	// Strategies run one at a time, so the others start after cancelling.
+	opts.Concurrency = 1
+	_, err := conspos.Run(ctx, filepath.Join("testdata", "examples", "consistent.fa"), opts)
+	var strategyErr *conspos.StrategyError
+	if !errors.As(err, &strategyErr) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run error = %v, want *StrategyError wrapping context.Canceled", err)
+	}
+}
+
+func TestRunCodonProgress(t *testing.T) {
+	// Strategies write progress messages concurrently, which is checked by
+	// running the tests with -race.
+	var progress bytes.Buffer
+	opts := fakeOptions()
+	opts.Codon = true
+	opts.GapChar = "---"
+	opts.Progress = &progress
+	if _, err := conspos.Run(context.Background(), filepath.Join("testdata", "codon", "codon.fa"), opts); err != nil {
+		t.Fatal(err)
+	}
+	strategies := len(opts.Aligner.DefaultStrategies())
+	if got := strings.Count(progress.String(), "C"); got != strategies {
+		t.Errorf("progress %q has %d codon alignments, want %d", progress.String(), got, strategies)
+	}
+	if !strings.HasSuffix(progress.String(), " Done.\n") {
+		t.Errorf("progress %q does not end with Done.", progress.String())
+	}
+}
+
+func TestRunInvalidInput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.fa")
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := conspos.Run(context.Background(), path, fakeOptions())
+	var invalid *conspos.InvalidInputError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Run error = %v, want *InvalidInputError", err)
+	}
+}
+
+// readmeMarkers returns the marker sequences of the ConsPos alignments
+// shown in README.md, in order.
+func readmeMarkers(t *testing.T) []string {
+	t.Helper()
+	f, err := os.Open("README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var markers []string
+	var inExample, nextIsMarker bool
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#### ConsPos alignment"):
+			inExample = true
+		case inExample && line == ">marker":
+			nextIsMarker = true
+		case nextIsMarker:
+			markers = append(markers, line)
+			inExample, nextIsMarker = false, false
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return markers
+}
+
+func TestREADMEExamples(t *testing.T) {
+	markers := readmeMarkers(t)
+	examples := []string{"consistent", "inconsistent"}
+	if len(markers) != len(examples) {
+		t.Fatalf("found %d examples in README.md, want %d", len(markers), len(examples))
+	}
+	for i, name := range examples {
+		res, err := conspos.Run(context.Background(), filepath.Join("testdata", "examples", name+".fa"), fakeOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := strings.SplitN(marked(res), "\n", 3)[1]
+		if got != markers[i] {
+			t.Errorf("%s: marker is\n%s\nREADME.md shows\n%s", name, got, markers[i])
+		}
+	}
+}
+
+func TestConsistencyScores(t *testing.T) {
+	template := [][]int{
+		{0, 1, -1, 2},
+		{0, -1, 1, 2},
+	}
+	same := [][]int{
+		{0, 1, -1, 2},
+		{0, -1, 1, 2},
+	}
+	shifted := [][]int{
+		{0, 1, 2, -1},
+		{0, -1, 1, 2},
+	}
+	got := conspos.ConsistencyScores(template, same, shifted)
+	want := []float64{1, 1, 2.0 / 3, 2.0 / 3}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("ConsistencyScores = %v, want %v", got, want)
+		}
+	}
+
+	consistentPos := conspos.ConsistentAlignmentPositions(template, same, shifted)
+	for i := range got {
+		if consistentPos[i] != (got[i] == 1) {
+			t.Errorf("position %d: consistent = %v but score = %v", i, consistentPos[i], got[i])
+		}
+	}
+}
+
+func TestRunScoresGolden(t *testing.T) {
+	res, err := conspos.Run(context.Background(), filepath.Join("testdata", "examples", "inconsistent.fa"), fakeOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := conspos.TrackedAlignmentToBuffer(res.TemplateAlignment(), res.ConsistentPos, "marker", "C", "N", conspos.Track{ID: "score", Scores: res.Scores})
+	checkGolden(t, "inconsistent_scores.aln", buffer.String())
+}
+
+func TestResiduePairScores(t *testing.T) {
+	template := [][]int{
+		{0, 1, 2},
+		{0, 1, 2},
+		{0, 1, -1},
+	}
+	// The residue at position 1 of the last sequence is aligned with position 2 of the others.
+	shifted := [][]int{
+		{0, 1, 2, -1},
+		{0, 1, 2, -1},
+		{0, -1, 1, -1},
+	}
+	got := conspos.ResiduePairScores(template, template, shifted)
+	// Position 1 has three pairs in the template, one of which is reproduced in shifted.
+	// Position 2 has a single pair that is reproduced in both alignments.
+	want := []float64{1, 4.0 / 6, 1}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-9 {
+			t.Fatalf("ResiduePairScores = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRunPairsGolden(t *testing.T) {
+	opts := fakeOptions()
+	opts.Metric = conspos.MetricPairs
+	res, err := conspos.Run(context.Background(), filepath.Join("testdata", "examples", "inconsistent.fa"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := conspos.TrackedAlignmentToBuffer(res.TemplateAlignment(), res.ConsistentPos, "marker", "C", "N", conspos.Track{ID: "score", Scores: res.Scores})
+	checkGolden(t, "inconsistent_pairs.aln", buffer.String())
+}
+
+func TestResidueScores(t *testing.T) {
+	template := [][]int{
+		{0, 1, 2},
+		{0, 1, 2},
+		{0, 1, -1},
+	}
+	shifted := [][]int{
+		{0, 1, 2, -1},
+		{0, 1, 2, -1},
+		{0, -1, 1, -1},
+	}
+	got := conspos.ResidueScores(template, template, shifted)
+	// Residue 1 of the last sequence is aligned with neither of its partners in shifted.
+	want := [][]float64{
+		{1, 3.0 / 4, 1},
+		{1, 3.0 / 4, 1},
+		{1, 2.0 / 4, -1},
+	}
+	for i := range want {
+		for j := range want[i] {
+			if math.Abs(got[i][j]-want[i][j]) > 1e-9 {
+				t.Fatalf("ResidueScores = %v, want %v", got, want)
+			}
+		}
+	}
+}
+
+func TestRunResidueScoresGolden(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		codon bool
+	}{
+		{"inconsistent", "testdata/examples/inconsistent.fa", false},
+		{"codon", "testdata/codon/codon.fa", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := fakeOptions()
+			opts.ResidueScores = true
+			opts.Codon = tt.codon
+			if tt.codon {
+				opts.GapChar = "---"
+			}
+			res, err := conspos.Run(context.Background(), tt.input, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fasta := conspos.ResidueScoresToBuffer(res.TemplateAlignment(), res.ResidueScores)
+			checkGolden(t, tt.name+"_residues.fa", fasta.String())
+			tsv := conspos.ResidueScoresToTSVBuffer(res.TemplateAlignment(), res.ResidueScores)
+			checkGolden(t, tt.name+"_residues.tsv", tsv.String())
+		})
+	}
+}
+
+func TestConsistencyScoresIgnoringGaps(t *testing.T) {
+	template := [][]int{
+		{0, 1, 2},
+		{0, -1, 1},
+	}
+	// The residue after the gap of the second sequence is moved into the gap.
+	moved := [][]int{
+		{0, 1, 2},
+		{0, 1, -1},
+	}
+	tests := []struct {
+		name string
+		got  []float64
+		want []float64
+	}{
+		{"match", conspos.ConsistencyScores(template, moved), []float64{1, 0.5, 0.5}},
+		{"ignore", conspos.ConsistencyScoresIgnoringGaps(template, moved), []float64{1, 1, 0.5}},
+		{"gap fractions", conspos.GapFractions(template), []float64{0, 0.5, 0}},
+	}
+	for _, tt := range tests {
+		for i := range tt.want {
+			if tt.got[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestRunMaxGapFraction(t *testing.T) {
+	opts := fakeOptions()
+	opts.MaxGapFraction = 0.3
+	res, err := conspos.Run(context.Background(), filepath.Join("testdata", "examples", "consistent.fa"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two of the five sequences have a gap at site 42.
+	for j, consistent := range res.ConsistentPos {
+		if consistent == (j == 41) {
+			t.Errorf("site %d: consistent = %v", j+1, consistent)
+		}
+	}
+}
@@ -1,21 +1,116 @@
-package main
+package conspos
 
 import (
+	"context"
 	"fmt"
-	"os"
+	"strings"
+	"time"
 )
 
-// EmptyAlnError writes to stderr that the resulting alignment from MAFFT is
-// empty.
-func EmptyAlnError(alnType, inputPath string) {
-	msg := fmt.Sprintf("Error: %s alignment from %s is empty.\nMAFFT may have encountered an error. Check if input sequences are valid.\n", alnType, inputPath)
-	os.Stderr.WriteString(msg)
-	os.Exit(1)
+// AlignerNotFoundError is returned when the executable of an alignment
+// program cannot be found.
+type AlignerNotFoundError struct {
+	// Path is the path to the executable that was looked up.
+	Path string
+	Err  error
 }
 
-// MafftError writes to stderr that something has gone wrong with MAFFT.
-func MafftError(err error) {
-	msg := fmt.Sprintf("Error: MAFFT did not exit properly.\n Check if input sequences are valid.\n%s\n", err)
-	os.Stderr.WriteString(msg)
-	os.Exit(1)
+func (e *AlignerNotFoundError) Error() string {
+	return fmt.Sprintf("alignment program not found at %s. Make sure that it is installed and is accessible at the specified path: %s", e.Path, e.Err)
+}
+
+func (e *AlignerNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// AlignerError is returned when an alignment program does not exit
+// properly.
+type AlignerError struct {
+	// Path is the path to the executable of the alignment program.
+	Path string
+	// Stderr is what the alignment program wrote to stderr.
+	Stderr string
+	Err    error
+}
+
+func (e *AlignerError) Error() string {
+	msg := fmt.Sprintf("%s did not exit properly: %s", e.Path, e.Err)
+	if stderr := strings.TrimSpace(e.Stderr); len(stderr) > 0 {
+		msg += "\n" + stderr
+	}
+	return msg
+}
+
+func (e *AlignerError) Unwrap() error {
+	return e.Err
+}
+
+// EmptyAlignmentError is returned when the alignment generated by a
+// strategy is empty.
+type EmptyAlignmentError struct {
+	Strategy  string
+	InputPath string
+}
+
+func (e *EmptyAlignmentError) Error() string {
+	return fmt.Sprintf("%s alignment from %s is empty. Check if input sequences are valid.", e.Strategy, e.InputPath)
+}
+
+// InvalidInputError is returned when the input sequences cannot be read
+// or cannot be aligned.
+type InvalidInputError struct {
+	InputPath string
+	Err       error
+}
+
+func (e *InvalidInputError) Error() string {
+	return fmt.Sprintf("invalid input %s: %s", e.InputPath, e.Err)
+}
+
+func (e *InvalidInputError) Unwrap() error {
+	return e.Err
+}
+
+// StrategyError is returned when an alignment strategy fails. It wraps the
+// error returned by the aligner.
+type StrategyError struct {
+	Strategy  string
+	InputPath string
+	Err       error
+}
+
+func (e *StrategyError) Error() string {
+	return fmt.Sprintf("%s alignment of %s failed: %s", e.Strategy, e.InputPath, e.Err)
+}
+
+func (e *StrategyError) Unwrap() error {
+	return e.Err
+}
+
+// TimeoutError is returned when a strategy does not finish within its time
+// limit, or within the time limit of the whole file.
+type TimeoutError struct {
+	Strategy  string
+	InputPath string
+	// Timeout is the time limit that was exceeded. It is zero if the
+	// deadline was set by the context given to the pipeline.
+	Timeout time.Duration
+	// PerFile indicates that the time limit of the whole file was exceeded
+	// while running the strategy.
+	PerFile bool
+}
+
+func (e *TimeoutError) Error() string {
+	limit := "its time limit"
+	if e.PerFile {
+		limit = "the time limit of the file"
+	}
+	if e.Timeout > 0 {
+		limit += fmt.Sprintf(" of %s", e.Timeout)
+	}
+	return fmt.Sprintf("%s alignment of %s timed out after exceeding %s", e.Strategy, e.InputPath, limit)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
 }
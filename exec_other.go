@@ -0,0 +1,9 @@
+//go:build !unix
+
+package conspos
+
+import "os/exec"
+
+// killProcessGroup leaves cmd to be killed by its context. Processes
+// started by cmd are not killed on this platform.
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,3 @@
+module github.com/kentwait/conspos
+
+go 1.20
@@ -0,0 +1,169 @@
+// Package fakealigner provides an aligner that returns canned alignments
+// instead of calling an alignment program, so that ConsPos can be tested
+// without installing MAFFT.
+//
+// Canned alignments are read from a directory. Each subdirectory holds the
+// alignments of one set of sequences, one file per strategy named
+// "<strategy>.fa". For a given input, the alignment returned is the one
+// whose sequences, with gaps removed, are the same as the input sequences.
+package fakealigner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kentwait/conspos"
+	fa "github.com/kentwait/gofasta"
+)
+
+// DirEnv is the environment variable that sets the directory of canned
+// alignments used by the fake MAFFT executable.
+const DirEnv = "CONSPOS_FAKE_ALIGNER_DIR"
+
+// Aligner returns the canned alignments found in Dir.
+type Aligner struct {
+	// Dir is the directory of canned alignments.
+	Dir string
+	// Strategies are the default strategies. If empty, the MAFFT default
+	// strategies are used.
+	Strategies []string
+}
+
+// Name returns "fake".
+func (a *Aligner) Name() string {
+	return "fake"
+}
+
+// DefaultStrategies returns Strategies, or the MAFFT default strategies if
+// Strategies is empty.
+func (a *Aligner) DefaultStrategies() []string {
+	if len(a.Strategies) > 0 {
+		return a.Strategies
+	}
+	return conspos.NewMafft("", 0).DefaultStrategies()
+}
+
+// Align returns the canned alignment of the strategy for the sequences
+// read from r.
+func (a *Aligner) Align(ctx context.Context, r io.Reader, strategy string, threads int) (fa.Alignment, error) {
+	input, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	output, err := Lookup(a.Dir, input, strategy)
+	if err != nil {
+		return nil, err
+	}
+	return fa.FastaToAlignment(bytes.NewReader(output), false), nil
+}
+
+// Lookup returns the canned alignment in dir of the strategy for the input
+// FASTA sequences.
+func Lookup(dir string, input []byte, strategy string) ([]byte, error) {
+	key := sequencesKey(input)
+	paths, err := filepath.Glob(filepath.Join(dir, "*", strategy+".fa"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		output, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if sequencesKey(output) == key {
+			return output, nil
+		}
+	}
+	return nil, fmt.Errorf("no canned %s alignment in %s matches the input", strategy, dir)
+}
+
+// sequencesKey returns the IDs and ungapped sequences in a FASTA file as a
+// single string used to match an input to a canned alignment.
+func sequencesKey(fasta []byte) string {
+	var key strings.Builder
+	for _, s := range fa.FastaToAlignment(bytes.NewReader(fasta), false) {
+		seq := strings.ToUpper(strings.Replace(s.Sequence(), "-", "", -1))
+		key.WriteString(s.ID() + "\n" + seq + "\n")
+	}
+	return key.String()
+}
+
+// Mafft imitates the command line of MAFFT as it is called by ConsPos. The
+// strategy is identified from args using the strategies of
+// conspos.NewMafft, sequences are read from stdin and the canned alignment
+// in dir is written to stdout. A guide tree given by --treein is checked
+// but does not change the alignment. Returns the exit status of the
+// program.
+func Mafft(dir string, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	// ConsPos calls MAFFT as:
+	// --thread N --maxiterate N <strategy arguments> [--treein file] --quiet -
+	if len(args) < 6 || args[0] != "--thread" || args[2] != "--maxiterate" || args[len(args)-1] != "-" {
+		fmt.Fprintf(stderr, "fake mafft: unexpected arguments %q\n", args)
+		return 1
+	}
+	args = args[4 : len(args)-2]
+	if len(args) >= 2 && args[len(args)-2] == "--treein" {
+		if err := checkTree(args[len(args)-1]); err != nil {
+			fmt.Fprintf(stderr, "fake mafft: %s\n", err)
+			return 1
+		}
+		args = args[:len(args)-2]
+	}
+	strategyArgs := strings.Join(args, " ")
+
+	var strategy string
+	for name, registered := range conspos.NewMafft("", 0).Strategies {
+		if strings.Join(registered, " ") == strategyArgs {
+			strategy = name
+		}
+	}
+	if len(strategy) == 0 {
+		fmt.Fprintf(stderr, "fake mafft: unknown strategy arguments %q\n", strategyArgs)
+		return 1
+	}
+
+	input, err := ioutil.ReadAll(stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "fake mafft: %s\n", err)
+		return 1
+	}
+	output, err := Lookup(dir, input, strategy)
+	if err != nil {
+		fmt.Fprintf(stderr, "fake mafft: %s\n", err)
+		return 1
+	}
+	stdout.Write(output)
+	return 0
+}
+
+// checkTree checks that the file at path is a guide tree in the format of
+// MAFFT, where each line has the two clusters merged and their branch
+// lengths.
+func checkTree(path string) error {
+	tree, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(tree)), "\n") {
+		var a, b int
+		var lengthA, lengthB float64
+		if _, err := fmt.Sscanf(line, "%d %d %f %f", &a, &b, &lengthA, &lengthB); err != nil || a >= b {
+			return fmt.Errorf("invalid guide tree line %q", line)
+		}
+	}
+	return nil
+}
+
+// RunMafftIfRequested runs Mafft and exits if DirEnv is set. Test binaries
+// call it from TestMain so that they can be used as the MAFFT executable.
+func RunMafftIfRequested() {
+	if dir := os.Getenv(DirEnv); len(dir) > 0 {
+		os.Exit(Mafft(dir, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+	}
+}
@@ -0,0 +1,134 @@
+package conspos
+
+import (
+	"bytes"
+	"encoding/json"
+
+	fa "github.com/kentwait/gofasta"
+)
+
+// JSONSchemaVersion is the version of the JSON format of results. It is
+// incremented when fields are removed or change meaning, but not when
+// fields are added.
+const JSONSchemaVersion = 1
+
+// JSONOptions sets what is written in the JSON format of results.
+type JSONOptions struct {
+	// Parameters are the parameters of the run recorded as metadata.
+	Parameters []Feature
+	// ConsistentMarker and InconsistentMarker are the characters of the
+	// marker string.
+	ConsistentMarker, InconsistentMarker string
+	// Alignments writes the alignment of each strategy in addition to the
+	// template alignment.
+	Alignments bool
+}
+
+// JSONResult is the JSON format of a Result. Arrays that hold a value per
+// site are as long as the template alignment, where the first element is
+// site 1.
+type JSONResult struct {
+	// SchemaVersion is JSONSchemaVersion.
+	SchemaVersion int `json:"schema_version"`
+	// Input is the path of the FASTA file that was aligned.
+	Input string `json:"input"`
+	// Strategies lists the alignment strategies in the order they were run.
+	Strategies []string `json:"strategies"`
+	// Template is the strategy whose alignment is the template.
+	Template string `json:"template"`
+	// Parameters maps the name of each parameter of the run to its value.
+	Parameters map[string]string `json:"parameters"`
+	// MinAgreement is the number of alignments, including the template,
+	// that must reproduce a site for it to be consistent. Omitted if
+	// MinWeight is set.
+	MinAgreement int `json:"min_agreement,omitempty"`
+	// MinWeight and TotalWeight are the summed weight of the alignments
+	// that must agree at a consistent site, and of all alignments. Omitted
+	// unless strategies are weighted.
+	MinWeight   float64 `json:"min_weight,omitempty"`
+	TotalWeight float64 `json:"total_weight,omitempty"`
+	// Alignment is the template alignment.
+	Alignment []JSONSequence `json:"alignment"`
+	// Marker has the consistent marker at consistent sites and the
+	// inconsistent marker elsewhere.
+	Marker string `json:"marker"`
+	// Consistent is whether each site is consistent.
+	Consistent []bool `json:"consistent"`
+	// Scores is the consistency score of each site between 0 and 1.
+	Scores []float64 `json:"scores"`
+	// Agreeing lists the strategies that share the alignment pattern of
+	// the template at each site.
+	Agreeing [][]string `json:"agreeing"`
+	// Weights is the summed weight of the alignments that agree with the
+	// template at each site. Omitted unless strategies are weighted.
+	Weights []float64 `json:"weights,omitempty"`
+	// Support is the bootstrap support of each site between 0 and 1.
+	// Omitted unless bootstrap replicates were aligned.
+	Support []float64 `json:"support,omitempty"`
+	// ResidueScores is the consistency score of each residue of each
+	// sequence of the template alignment, where gaps are -1. Omitted
+	// unless residue scores were computed.
+	ResidueScores [][]float64 `json:"residue_scores,omitempty"`
+	// Alignments maps each strategy to its alignment. Omitted unless
+	// requested.
+	Alignments map[string][]JSONSequence `json:"alignments,omitempty"`
+}
+
+// JSONSequence is the JSON format of an aligned sequence.
+type JSONSequence struct {
+	ID          string `json:"id"`
+	Description string `json:"description,omitempty"`
+	Sequence    string `json:"sequence"`
+}
+
+// NewJSONResult converts res into its JSON format.
+func NewJSONResult(res Result, opts JSONOptions) JSONResult {
+	parameters := make(map[string]string)
+	for _, p := range opts.Parameters {
+		parameters[p.Tag] = p.Text
+	}
+	j := JSONResult{
+		SchemaVersion: JSONSchemaVersion,
+		Input:         res.InputPath,
+		Strategies:    res.Strategies,
+		Template:      res.Template,
+		Parameters:    parameters,
+		MinWeight:     res.MinWeight,
+		TotalWeight:   res.TotalWeight,
+		Alignment:     jsonSequences(res.TemplateAlignment()),
+		Marker:        markerString(res.ConsistentPos, opts.ConsistentMarker, opts.InconsistentMarker),
+		Consistent:    res.ConsistentPos,
+		Scores:        res.Scores,
+		Agreeing:      res.Agreement.Agreeing,
+		Weights:       res.Weight,
+		Support:       res.Support,
+		ResidueScores: res.ResidueScores,
+	}
+	if res.MinWeight == 0 {
+		j.MinAgreement = res.MinAgreement
+	}
+	if opts.Alignments {
+		j.Alignments = make(map[string][]JSONSequence)
+		for strategy, aln := range res.Alignments {
+			j.Alignments[strategy] = jsonSequences(aln)
+		}
+	}
+	return j
+}
+
+// jsonSequences converts the sequences of aln into their JSON format.
+func jsonSequences(aln fa.Alignment) []JSONSequence {
+	seqs := make([]JSONSequence, len(aln))
+	for i, s := range aln {
+		seqs[i] = JSONSequence{ID: s.ID(), Description: s.Description(), Sequence: s.Sequence()}
+	}
+	return seqs
+}
+
+// JSONToBuffer writes res in the JSON format given by JSONResult to the
+// buffer, on a single line.
+func JSONToBuffer(res Result, opts JSONOptions) (bytes.Buffer, error) {
+	var buffer bytes.Buffer
+	err := json.NewEncoder(&buffer).Encode(NewJSONResult(res, opts))
+	return buffer, err
+}
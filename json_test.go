@@ -0,0 +1,61 @@
+package conspos_test
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kentwait/conspos"
+)
+
+func TestJSONToBuffer(t *testing.T) {
+	res, err := conspos.Run(context.Background(), filepath.Join("testdata", "examples", "inconsistent.fa"), fakeOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := conspos.JSONOptions{
+		Parameters:         []conspos.Feature{{Tag: "metric", Text: "column"}},
+		ConsistentMarker:   "C",
+		InconsistentMarker: "N",
+	}
+	buffer, err := conspos.JSONToBuffer(res, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(buffer.String(), "\n") != 1 {
+		t.Errorf("JSON is not written on a single line:\n%s", buffer.String())
+	}
+	var got conspos.JSONResult
+	if err := json.Unmarshal(buffer.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	// The marker is the same as in the marked FASTA alignment.
+	if want := strings.SplitN(marked(res), "\n", 3)[1]; got.Marker != want {
+		t.Errorf("marker = %s, want %s", got.Marker, want)
+	}
+	if got.SchemaVersion != conspos.JSONSchemaVersion || got.Template != "einsi" || got.MinAgreement != 3 || got.Parameters["metric"] != "column" {
+		t.Errorf("metadata = version %d, template %s, min_agreement %d, parameters %v", got.SchemaVersion, got.Template, got.MinAgreement, got.Parameters)
+	}
+	sites := len(got.Alignment[0].Sequence)
+	if len(got.Consistent) != sites || len(got.Scores) != sites || len(got.Agreeing) != sites {
+		t.Errorf("%d consistent, %d scores and %d agreeing values for %d sites", len(got.Consistent), len(got.Scores), len(got.Agreeing), sites)
+	}
+	if got.Support != nil || got.Alignments != nil {
+		t.Error("support and alignments are written without being requested")
+	}
+
+	opts.Alignments = true
+	if buffer, err = conspos.JSONToBuffer(res, opts); err != nil {
+		t.Fatal(err)
+	}
+	got = conspos.JSONResult{}
+	if err := json.Unmarshal(buffer.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Alignments) != len(res.Strategies) {
+		t.Errorf("%d alignments, want %d", len(got.Alignments), len(res.Strategies))
+	}
+}
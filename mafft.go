@@ -1,201 +1,145 @@
-package main
+package conspos
 
 import (
+	"context"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
-	"os/exec"
-	"runtime"
 	"strconv"
 	"strings"
 
 	fa "github.com/kentwait/gofasta"
 )
 
-// MAFFT functions for nucleotide and protein alignments
+// Mafft aligns sequences using the MAFFT program.
+type Mafft struct {
+	// Path is the path to the MAFFT executable.
+	Path string
+	// Iterations is the maximum number of iterative refinement that
+	// MAFFT will perform.
+	Iterations int
+	// Strategies maps strategy names to MAFFT arguments.
+	Strategies StrategyArgs
+}
 
-// ExecMafft calls the MAFFT program with the given arguments.
-// Returns stdout as a string and nil if no errors are encountered.
-// If an error occurs, returns a nil string and the error encountered.
-func ExecMafft(mafftCmd string, args []string) (string, error) {
-	// Check if mafftCmd is in $PATH and returns its absolute path.
-	// However, if mafftCmd contains slashes, exec.LookPath assumes this is the absolute/relative path to the program.
-	// Because of this, exec.LookPath will not look in $PATH and directly try to run mafftCmd using the given path.
-	// Panics if LookPath returns an error
-	absPath, lookErr := exec.LookPath(mafftCmd)
-	if lookErr != nil {
-		// TODO: Handle this without panicking, Return error instead
-		panic(lookErr)
+// NewMafft returns a MAFFT aligner with the following strategies
+// registered:
+//   - "ginsi", "linsi" and "einsi" are the iterative global (G-INSI),
+//     local (L-INSI) and affine-gap local (E-INSI) strategies.
+//   - "fftns1" and "fftns2" are the progressive FFT-NS-1 and FFT-NS-2
+//     strategies, and "fftnsi" is the iterative FFT-NS-i strategy.
+//   - "nwns2" and "nwnsi" are FFT-NS-2 and FFT-NS-i without FFT
+//     approximation (NW-NS-2 and NW-NS-i).
+//   - "auto" lets MAFFT choose a strategy depending on the data size.
+//
+// Progressive strategies override Iterations and do not perform
+// iterative refinement.
+func NewMafft(path string, iterations int) *Mafft {
+	return &Mafft{
+		Path:       path,
+		Iterations: iterations,
+		Strategies: StrategyArgs{
+			"ginsi":  {"--globalpair"},
+			"linsi":  {"--localpair"},
+			"einsi":  {"--genafpair"},
+			"fftns1": {"--retree", "1", "--maxiterate", "0"},
+			"fftns2": {"--retree", "2", "--maxiterate", "0"},
+			"fftnsi": {"--retree", "2"},
+			"nwns2":  {"--retree", "2", "--maxiterate", "0", "--nofft"},
+			"nwnsi":  {"--retree", "2", "--nofft"},
+			"auto":   {"--auto"},
+		},
 	}
+}
 
-	// Sets the number of threads MAFFT will use by getting the number of CPUs minus 1
-	// TODO: Allow the user to set this manually and only use all CPUs when set to -1
-	threads := runtime.NumCPU() - 1
-	args = append([]string{"--thread", strconv.Itoa(threads)}, args...)
+// Name returns "mafft".
+func (m *Mafft) Name() string {
+	return "mafft"
+}
 
-	// TODO: Add debug/verbose state which outputs the MAFFT call to stderr
-	// Output MAFFT call
-	// os.Stderr.WriteString(absPath + " " + strings.Join(args, " ") + "\n")
-
-	// Builds the command to execute the MAFFT program from the path, and for the given set of arguments
-	// This does not execute the program and the arguments yet.
-	// It only creates the struct containing the necessary information to execute the program.
-	cmd := exec.Command(absPath, args...)
-	// Calling .Output() executes the command and captures stdout, discards sterr.
-	stdout, err := cmd.Output()
-	// Check if the program returned an error
-	if err != nil {
-		// TODO: Do not exit, return error instead.
-		MafftError(err)
-		os.Exit(1)
-	}
+// DefaultStrategies returns the G-INSI, L-INSI and E-INSI strategies.
+func (m *Mafft) DefaultStrategies() []string {
+	return []string{"ginsi", "linsi", "einsi"}
+}
 
-	// No errors encountered, returns stdout as a string and nil error.
-	return string(stdout), nil
+// Register adds a strategy named name that calls MAFFT using the given
+// arguments.
+func (m *Mafft) Register(name string, args ...string) {
+	m.Strategies.Register(name, args...)
 }
 
-// ExecMafftStdin calls the MAFFT program with the given arguments and using standard input as input.
-// Returns stdout as a string and nil if no errors are encountered.
-// If an error occurs, returns a nil string and the error encountered.
-func ExecMafftStdin(mafftCmd string, stdin io.Reader, args []string) (string, error) {
-	// TODO: Combine with ExecMafft?
-	absPath, lookErr := exec.LookPath(mafftCmd)
-	if lookErr != nil {
-		panic(lookErr)
-	}
-	args = append(args, "-")
+// HasStrategy reports whether the strategy is registered.
+func (m *Mafft) HasStrategy(name string) bool {
+	_, ok := m.Strategies[name]
+	return ok
+}
 
-	cmd := exec.Command(absPath, args...)
-	cmd.Stdin = stdin
+// StrategyNames returns the registered strategies.
+func (m *Mafft) StrategyNames() []string {
+	return m.Strategies.names()
+}
 
-	stdout, err := cmd.Output()
-	if err != nil {
-		MafftError(err)
-		os.Exit(1)
-	}
-	return string(stdout), nil
+// Align calls MAFFT to align the sequences read from r depending on the
+// specified alignment strategy.
+func (m *Mafft) Align(ctx context.Context, r io.Reader, strategy string, threads int) (fa.Alignment, error) {
+	return m.align(ctx, r, strategy, threads, nil)
 }
 
-// CharAlign calls MAFFT to align sequences depending on the specified alignment method.
-func CharAlign(mafftCmd, fastaPath string, method string, iterations int) string {
-	var methodFlag, indicatorChar string
-	if method == "einsi" {
-		methodFlag = "--genafpair"
-		indicatorChar = "E"
-	} else if method == "linsi" {
-		methodFlag = "--localpair"
-		indicatorChar = "L"
-	} else if method == "ginsi" {
-		methodFlag = "--globalpair"
-		indicatorChar = "G"
+// AlignWithTree calls MAFFT to align the sequences read from r depending
+// on the specified alignment strategy, using the given guide tree through
+// the --treein option.
+func (m *Mafft) AlignWithTree(ctx context.Context, r io.Reader, strategy string, tree GuideTree, threads int) (fa.Alignment, error) {
+	f, err := ioutil.TempFile("", "conspos-tree")
+	if err != nil {
+		return nil, err
 	}
-	var args []string
-	args = append(args, []string{
-		"--maxiterate",
-		strconv.Itoa(iterations),
-		methodFlag,
-		"--quiet",
-		fastaPath,
-	}...)
-	// TODO: Add verbosity level to silence output
-	os.Stderr.WriteString(indicatorChar)
-	stdout, _ := ExecMafft(mafftCmd, args)
-	return stdout
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(tree.MafftFormat())
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	return m.align(ctx, r, strategy, threads, []string{"--treein", f.Name()})
 }
 
-// CharAlignStdin calls MAFFT to align sequences depending on the specified alignment method coming from standard input.
-func CharAlignStdin(mafftCmd string, r io.Reader, method string, iterations int) string {
-	var methodFlag, indicatorChar string
-	if method == "einsi" {
-		methodFlag = "--genafpair"
-		indicatorChar = "E"
-	} else if method == "linsi" {
-		methodFlag = "--localpair"
-		indicatorChar = "L"
-	} else if method == "ginsi" {
-		methodFlag = "--globalpair"
-		indicatorChar = "G"
+// align calls MAFFT using the arguments of the strategy followed by
+// extraArgs.
+func (m *Mafft) align(ctx context.Context, r io.Reader, strategy string, threads int, extraArgs []string) (fa.Alignment, error) {
+	strategyArgs, ok := m.Strategies[strategy]
+	if !ok {
+		return nil, fmt.Errorf("unknown MAFFT strategy %q", strategy)
 	}
+	// Arguments of the strategy come after --maxiterate so that a strategy
+	// can override the number of iterations.
 	var args []string
-	args = append(args, []string{
-		"--maxiterate",
-		strconv.Itoa(iterations),
-		methodFlag,
-		"--quiet",
-	}...)
-	// TODO: Add verbosity level to silence output
-	os.Stderr.WriteString(indicatorChar)
-	stdout, _ := ExecMafftStdin(mafftCmd, r, args)
-	return stdout
-}
+	args = append(args, "--maxiterate", strconv.Itoa(m.Iterations))
+	args = append(args, strategyArgs...)
+	args = append(args, extraArgs...)
+	args = append(args, "--quiet")
 
-// MAFFT functions for codon alignemnts
-
-// CodonAlign calls MAFFT to align codon sequences depending on the specified alignment method.
-func CodonAlign(mafftCmd, method string, fastaPath string, iterations int, c fa.Alignment) string {
-	var methodFlag, indicatorChar string
-	if method == "einsi" {
-		methodFlag = "--genafpair"
-		indicatorChar = "E"
-	} else if method == "linsi" {
-		methodFlag = "--localpair"
-		indicatorChar = "L"
-	} else if method == "ginsi" {
-		methodFlag = "--globalpair"
-		indicatorChar = "G"
+	stdout, err := ExecMafft(ctx, m.Path, r, threads, args)
+	if err != nil {
+		return nil, err
 	}
-	var args []string
-	args = append(args, []string{
-		"--maxiterate",
-		strconv.Itoa(iterations),
-		methodFlag,
-		"--quiet",
-		fastaPath,
-	}...)
-	// TODO: Add verbosity level to silence output
-	os.Stderr.WriteString(indicatorChar)
-	stdout, _ := ExecMafft(mafftCmd, args)
-	// Create CharSequences from protein alignment
-	p := fa.FastaToAlignment(strings.NewReader(stdout), false)
-
-	// Use protein alignment to offset codons and match alignment. Output as Fasta string
-	buff := AlignCodonsUsingProtAlignment(c, p)
-	newStdout := buff.String()
-	os.Stderr.WriteString("C")
-
-	return newStdout
+	return fa.FastaToAlignment(strings.NewReader(stdout), false), nil
 }
 
-// CodonAlignStdin calls MAFFT to align codon sequences depending on the specified alignment method coming from standard input.
-func CodonAlignStdin(mafftCmd string, r io.Reader, method string, iterations int, c fa.Alignment) string {
-	var methodFlag, indicatorChar string
-	if method == "einsi" {
-		methodFlag = "--genafpair"
-		indicatorChar = "E"
-	} else if method == "linsi" {
-		methodFlag = "--localpair"
-		indicatorChar = "L"
-	} else if method == "ginsi" {
-		methodFlag = "--globalpair"
-		indicatorChar = "G"
-	}
-	var args []string
-	args = append(args, []string{
-		"--maxiterate",
-		strconv.Itoa(iterations),
-		methodFlag,
-		"--quiet",
-	}...)
-	// TODO: Add verbosity level to silence output
-	os.Stderr.WriteString(indicatorChar)
-	stdout, _ := ExecMafftStdin(mafftCmd, r, args)
-
-	// Create CharSequences from protein alignment
-	p := fa.FastaToAlignment(strings.NewReader(stdout), false)
-
-	// Use protein alignment to offset codons and match alignment. Output as Fasta string
-	buff := AlignCodonsUsingProtAlignment(c, p)
-	newStdout := buff.String()
-	os.Stderr.WriteString("C")
-
-	return newStdout
+// ExecMafft calls the MAFFT program with the given arguments and number of
+// threads, and using standard input as input.
+// Returns stdout as a string and nil if no errors are encountered.
+// If an error occurs, returns an empty string and the error encountered.
+func ExecMafft(ctx context.Context, mafftCmd string, stdin io.Reader, threads int, args []string) (string, error) {
+	// Sets the number of threads MAFFT will use
+	args = append([]string{"--thread", strconv.Itoa(threads)}, args...)
+	// MAFFT reads the sequences from stdin when the input is "-"
+	args = append(args, "-")
+
+	// TODO: Add debug/verbose state which outputs the MAFFT call to stderr
+	// Output MAFFT call
+	// os.Stderr.WriteString(mafftCmd + " " + strings.Join(args, " ") + "\n")
+
+	// If mafftCmd contains slashes, it is used as the absolute/relative path to the program.
+	// Otherwise, MAFFT is looked up in $PATH.
+	return execAligner(ctx, mafftCmd, stdin, args)
 }
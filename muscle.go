@@ -0,0 +1,139 @@
+package conspos
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	fa "github.com/kentwait/gofasta"
+)
+
+// Muscle aligns sequences using the MUSCLE 5 program.
+type Muscle struct {
+	// Path is the path to the MUSCLE executable.
+	Path string
+	// Strategies maps strategy names to MUSCLE arguments.
+	// Besides the registered strategies, any strategy named "perturb"
+	// followed by an integer seed, such as "perturb3", runs MUSCLE with
+	// "-perturb" and that seed.
+	Strategies StrategyArgs
+}
+
+// NewMuscle returns a MUSCLE aligner with strategies registered for each
+// guide tree permutation: "perm-none", "perm-abc", "perm-acb" and
+// "perm-bca".
+func NewMuscle(path string) *Muscle {
+	return &Muscle{
+		Path: path,
+		Strategies: StrategyArgs{
+			"perm-none": {"-perm", "none"},
+			"perm-abc":  {"-perm", "abc"},
+			"perm-acb":  {"-perm", "acb"},
+			"perm-bca":  {"-perm", "bca"},
+		},
+	}
+}
+
+// Name returns "muscle".
+func (m *Muscle) Name() string {
+	return "muscle"
+}
+
+// DefaultStrategies returns the four guide tree permutation strategies.
+func (m *Muscle) DefaultStrategies() []string {
+	return []string{"perm-none", "perm-abc", "perm-acb", "perm-bca"}
+}
+
+// Register adds a strategy named name that calls MUSCLE using the given
+// arguments.
+func (m *Muscle) Register(name string, args ...string) {
+	m.Strategies.Register(name, args...)
+}
+
+// HasStrategy reports whether the strategy is registered or is a perturb
+// strategy.
+func (m *Muscle) HasStrategy(name string) bool {
+	_, ok := m.strategyArgs(name)
+	return ok
+}
+
+// StrategyNames returns the registered strategies and "perturb<seed>".
+func (m *Muscle) StrategyNames() []string {
+	return append(m.Strategies.names(), "perturb<seed>")
+}
+
+// strategyArgs returns the MUSCLE arguments of the given strategy.
+func (m *Muscle) strategyArgs(strategy string) ([]string, bool) {
+	if args, ok := m.Strategies[strategy]; ok {
+		return args, true
+	}
+	if seed, ok := strategyNumber(strategy, "perturb"); ok {
+		return []string{"-perturb", strconv.Itoa(seed)}, true
+	}
+	return nil, false
+}
+
+// Align calls MUSCLE to align the sequences read from r depending on the
+// specified alignment strategy. The aligned sequences are returned in the
+// same order as the input.
+func (m *Muscle) Align(ctx context.Context, r io.Reader, strategy string, threads int) (fa.Alignment, error) {
+	strategyArgs, ok := m.strategyArgs(strategy)
+	if !ok {
+		return nil, fmt.Errorf("unknown MUSCLE strategy %q", strategy)
+	}
+	input, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := ExecMuscle(ctx, m.Path, bytes.NewReader(input), threads, strategyArgs)
+	if err != nil {
+		return nil, err
+	}
+	aln := fa.FastaToAlignment(strings.NewReader(stdout), false)
+	return reorderAlignment(aln, fa.FastaToAlignment(bytes.NewReader(input), false))
+}
+
+// ExecMuscle calls the MUSCLE program with the given arguments and number
+// of threads.
+// MUSCLE 5 only reads from and writes to files, so the sequences read from
+// stdin are written to a temporary file and the resulting alignment is
+// read back from another.
+// Returns the alignment as a string and nil if no errors are encountered.
+// If an error occurs, returns an empty string and the error encountered.
+func ExecMuscle(ctx context.Context, muscleCmd string, stdin io.Reader, threads int, args []string) (string, error) {
+	tempDir, err := ioutil.TempDir("", "conspos-muscle")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputPath := filepath.Join(tempDir, "input.fa")
+	outputPath := filepath.Join(tempDir, "output.afa")
+	f, err := os.Create(inputPath)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, stdin)
+	f.Close()
+	if err != nil {
+		return "", err
+	}
+
+	args = append([]string{"-align", inputPath, "-output", outputPath, "-threads", strconv.Itoa(threads)}, args...)
+	if _, err := execAligner(ctx, muscleCmd, nil, args); err != nil {
+		return "", err
+	}
+
+	output, err := ioutil.ReadFile(outputPath)
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
@@ -0,0 +1,30 @@
+package conspos
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMuscleStrategyArgs(t *testing.T) {
+	m := NewMuscle("muscle")
+	tests := []struct {
+		strategy string
+		want     []string
+		ok       bool
+	}{
+		{"perm-abc", []string{"-perm", "abc"}, true},
+		{"perturb3", []string{"-perturb", "3"}, true},
+		{"perturb0", []string{"-perturb", "0"}, true},
+		{"perturb", nil, false},
+		{"perturbx", nil, false},
+		{"perturb-1", nil, false},
+		{"perturb+3", nil, false},
+		{"perm-xyz", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := m.strategyArgs(tt.strategy)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("strategyArgs(%q) = %q, %v, want %q, %v", tt.strategy, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,560 @@
+package conspos
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	fa "github.com/kentwait/gofasta"
+)
+
+// NativeMode sets the parameters of a strategy of the native aligner.
+type NativeMode struct {
+	// Local computes the distances used to build the guide tree from
+	// Smith-Waterman local alignments instead of Needleman-Wunsch global
+	// alignments.
+	Local bool
+	// GapOpen is the penalty of the first position of a gap and GapExtend
+	// the penalty of each following position.
+	GapOpen   float64
+	GapExtend float64
+	// FreeEndGaps does not penalize gaps at either end of the alignment.
+	FreeEndGaps bool
+}
+
+// Native aligns sequences using a built-in progressive aligner that does
+// not depend on any external program.
+//
+// Pairwise distances between sequences are computed from their identity
+// in pairwise alignments. The sequences are then progressively aligned by
+// profile alignment following a UPGMA guide tree built from the distances.
+//
+// Each pairwise alignment keeps its whole dynamic programming matrix in
+// memory, 27 bytes for each pair of positions, and as many pairs are
+// aligned at the same time as there are threads. Two sequences of 10,000
+// residues take about 2.7 GB per thread, so the native aligner is meant
+// for sequences of up to a few thousand residues such as genes.
+type Native struct {
+	// Modes maps strategy names to alignment parameters.
+	Modes map[string]NativeMode
+}
+
+// NewNative returns a native aligner with the following strategies
+// registered:
+//   - "global" uses global pairwise alignments and penalizes end gaps.
+//   - "local" uses local pairwise alignments with a linear gap penalty.
+//   - "affine-local" uses local pairwise alignments with an affine gap
+//     penalty that favors fewer but longer gaps.
+func NewNative() *Native {
+	return &Native{
+		Modes: map[string]NativeMode{
+			"global":       {Local: false, GapOpen: 10, GapExtend: 1, FreeEndGaps: false},
+			"local":        {Local: true, GapOpen: 4, GapExtend: 4, FreeEndGaps: true},
+			"affine-local": {Local: true, GapOpen: 12, GapExtend: 0.5, FreeEndGaps: true},
+		},
+	}
+}
+
+// Name returns "native".
+func (n *Native) Name() string {
+	return "native"
+}
+
+// DefaultStrategies returns the global, local and affine-local strategies.
+func (n *Native) DefaultStrategies() []string {
+	return []string{"global", "local", "affine-local"}
+}
+
+// HasStrategy reports whether the strategy has a mode.
+func (n *Native) HasStrategy(name string) bool {
+	_, ok := n.Modes[name]
+	return ok
+}
+
+// StrategyNames returns the strategies that have a mode.
+func (n *Native) StrategyNames() []string {
+	var names []string
+	for name := range n.Modes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Align aligns the sequences read from r using the specified strategy.
+// Gaps in the input are removed before aligning. Pairwise distances are
+// computed using the given number of threads.
+func (n *Native) Align(ctx context.Context, r io.Reader, strategy string, threads int) (fa.Alignment, error) {
+	return n.align(r, strategy, func(seqs []string, sub *substitution, mode NativeMode) ([]string, error) {
+		return progressiveAlign(ctx, seqs, sub, mode, threads)
+	})
+}
+
+// AlignWithTree aligns the sequences read from r using the specified
+// strategy, following the given guide tree instead of a guide tree built
+// from pairwise distances.
+func (n *Native) AlignWithTree(ctx context.Context, r io.Reader, strategy string, tree GuideTree, threads int) (fa.Alignment, error) {
+	return n.align(r, strategy, func(seqs []string, sub *substitution, mode NativeMode) ([]string, error) {
+		if err := tree.check(len(seqs)); err != nil {
+			return nil, err
+		}
+		return alignTree(ctx, seqs, sub, mode, tree)
+	})
+}
+
+// align reads the sequences from r, removes their gaps and aligns them
+// using alignSeqs and the mode of the strategy.
+func (n *Native) align(r io.Reader, strategy string, alignSeqs func(seqs []string, sub *substitution, mode NativeMode) ([]string, error)) (fa.Alignment, error) {
+	mode, ok := n.Modes[strategy]
+	if !ok {
+		return nil, fmt.Errorf("unknown native strategy %q", strategy)
+	}
+	input := fa.FastaToAlignment(r, false)
+	if len(input) == 0 {
+		return input, nil
+	}
+
+	seqs := make([]string, len(input))
+	for i, s := range input {
+		seqs[i] = strings.Replace(s.Sequence(), "-", "", -1)
+	}
+	aligned, err := alignSeqs(seqs, guessSubstitution(seqs), mode)
+	if err != nil {
+		return nil, err
+	}
+
+	var buff bytes.Buffer
+	for i, s := range input {
+		if len(s.Description()) > 0 {
+			buff.WriteString(fmt.Sprintf(">%s %s\n", s.ID(), s.Description()))
+		} else {
+			buff.WriteString(fmt.Sprintf(">%s\n", s.ID()))
+		}
+		buff.WriteString(aligned[i] + "\n")
+	}
+	return fa.FastaToAlignment(&buff, false), nil
+}
+
+// profile is a set of aligned sequences.
+type profile struct {
+	// members are the indices of the aligned sequences in the input.
+	members []int
+	// rows are the aligned sequences.
+	rows [][]byte
+}
+
+// columnFrequencies returns the frequency of each residue per column of
+// the profile. Gaps do not count towards any residue.
+func (p *profile) columnFrequencies(sub *substitution) [][]float64 {
+	if len(p.rows) == 0 {
+		return nil
+	}
+	freqs := make([][]float64, len(p.rows[0]))
+	for j := range freqs {
+		freqs[j] = make([]float64, len(sub.scores))
+		for _, row := range p.rows {
+			if row[j] != '-' {
+				freqs[j][sub.index[row[j]]] += 1 / float64(len(p.rows))
+			}
+		}
+	}
+	return freqs
+}
+
+// progressiveAlign aligns the ungapped sequences and returns the aligned
+// sequences in the same order. Returns the error of ctx if ctx is done.
+func progressiveAlign(ctx context.Context, seqs []string, sub *substitution, mode NativeMode, threads int) ([]string, error) {
+	dist, err := pairwiseDistances(ctx, seqs, sub, mode, threads)
+	if err != nil {
+		return nil, err
+	}
+	return alignTree(ctx, seqs, sub, mode, guideTree(dist))
+}
+
+// alignTree aligns the ungapped sequences following the guide tree and
+// returns the aligned sequences in the same order. Returns the error of
+// ctx if ctx is done.
+func alignTree(ctx context.Context, seqs []string, sub *substitution, mode NativeMode, tree GuideTree) ([]string, error) {
+	profiles := make([]*profile, len(seqs))
+	for i, seq := range seqs {
+		profiles[i] = &profile{members: []int{i}, rows: [][]byte{[]byte(seq)}}
+	}
+
+	// Merges profiles following the order given by the guide tree
+	for _, pair := range tree.Merges {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		profiles[pair[0]] = alignProfiles(profiles[pair[0]], profiles[pair[1]], sub, mode)
+		profiles[pair[1]] = nil
+	}
+
+	aligned := make([]string, len(seqs))
+	for _, p := range profiles {
+		if p == nil {
+			continue
+		}
+		for k, i := range p.members {
+			aligned[i] = string(p.rows[k])
+		}
+	}
+	return aligned, nil
+}
+
+// pairwiseDistances returns the distance between every pair of sequences
+// as one minus their identity in a pairwise alignment. Pairs are aligned
+// using the given number of threads.
+// Returns the error of ctx if ctx is done.
+func pairwiseDistances(ctx context.Context, seqs []string, sub *substitution, mode NativeMode, threads int) ([][]float64, error) {
+	encoded := make([][]int, len(seqs))
+	for i, seq := range seqs {
+		encoded[i] = sub.encode(seq)
+	}
+	dist := make([][]float64, len(seqs))
+	for i := range dist {
+		dist[i] = make([]float64, len(seqs))
+	}
+
+	// Each worker computes the distances of the pairs it receives.
+	// Every pair is written to different cells so no locking is needed.
+	if threads < 1 {
+		threads = 1
+	}
+	pairs := make(chan [2]int)
+	var wg sync.WaitGroup
+	for w := 0; w < threads; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pair := range pairs {
+				i, j := pair[0], pair[1]
+				d := pairwiseDistance(encoded[i], encoded[j], sub, mode)
+				dist[i][j], dist[j][i] = d, d
+			}
+		}()
+	}
+sendPairs:
+	for i := 0; i < len(seqs); i++ {
+		for j := i + 1; j < len(seqs); j++ {
+			select {
+			case pairs <- [2]int{i, j}:
+			case <-ctx.Done():
+				break sendPairs
+			}
+		}
+	}
+	close(pairs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return dist, nil
+}
+
+// pairwiseDistance returns one minus the identity of the encoded sequences
+// a and b in a pairwise alignment.
+func pairwiseDistance(a, b []int, sub *substitution, mode NativeMode) float64 {
+	ops, ai, bj := gotoh(len(a), len(b), func(x, y int) float64 {
+		return sub.score(a[x], b[y])
+	}, mode.GapOpen, mode.GapExtend, mode.FreeEndGaps, mode.Local)
+
+	// Counts identical residues and aligned residue pairs
+	var matches, pairs int
+	for _, op := range ops {
+		switch op {
+		case opMatch:
+			if a[ai] == b[bj] {
+				matches++
+			}
+			pairs++
+			ai++
+			bj++
+		case opGapB:
+			ai++
+		case opGapA:
+			bj++
+		}
+	}
+	// Local alignments can cover only a short region, so identity is
+	// relative to the shorter sequence instead of the aligned pairs.
+	if mode.Local {
+		pairs = len(a)
+		if len(b) < pairs {
+			pairs = len(b)
+		}
+	}
+	if pairs == 0 {
+		return 1
+	}
+	return 1 - float64(matches)/float64(pairs)
+}
+
+// guideTree clusters sequences by UPGMA and returns the guide tree. The
+// distances are modified in the process.
+func guideTree(dist [][]float64) GuideTree {
+	size := make([]int, len(dist))
+	active := make([]bool, len(dist))
+	// height is the distance from each cluster to its sequences.
+	height := make([]float64, len(dist))
+	for i := range dist {
+		size[i] = 1
+		active[i] = true
+	}
+
+	var tree GuideTree
+	for len(tree.Merges) < len(dist)-1 {
+		// Finds the closest pair of clusters
+		a, b := -1, -1
+		for i := range dist {
+			for j := i + 1; j < len(dist); j++ {
+				if active[i] && active[j] && (a < 0 || dist[i][j] < dist[a][b]) {
+					a, b = i, j
+				}
+			}
+		}
+		// The merged cluster is halfway between a and b
+		mergedHeight := dist[a][b] / 2
+		tree.Lengths = append(tree.Lengths, [2]float64{nonNegative(mergedHeight - height[a]), nonNegative(mergedHeight - height[b])})
+		height[a] = mergedHeight
+
+		// Merges b into a and updates distances as the size-weighted average
+		for k := range dist {
+			if active[k] && k != a && k != b {
+				d := (dist[a][k]*float64(size[a]) + dist[b][k]*float64(size[b])) / float64(size[a]+size[b])
+				dist[a][k], dist[k][a] = d, d
+			}
+		}
+		size[a] += size[b]
+		active[b] = false
+		tree.Merges = append(tree.Merges, [2]int{a, b})
+	}
+	return tree
+}
+
+// nonNegative returns x, or 0 if x is negative.
+func nonNegative(x float64) float64 {
+	if x < 0 {
+		return 0
+	}
+	return x
+}
+
+// alignProfiles aligns two profiles and returns the merged profile.
+// Columns are scored by the average substitution score over all pairs of
+// residues in the two columns.
+func alignProfiles(a, b *profile, sub *substitution, mode NativeMode) *profile {
+	freqA, freqB := a.columnFrequencies(sub), b.columnFrequencies(sub)
+
+	// Precomputes the expected score of each column of a against each
+	// residue so that scoring a pair of columns is a dot product.
+	expA := make([][]float64, len(freqA))
+	for i, f := range freqA {
+		expA[i] = make([]float64, len(sub.scores))
+		for x, fx := range f {
+			if fx == 0 {
+				continue
+			}
+			for y := range expA[i] {
+				expA[i][y] += fx * sub.score(x, y)
+			}
+		}
+	}
+	score := func(i, j int) float64 {
+		var s float64
+		for y, fy := range freqB[j] {
+			if fy != 0 {
+				s += expA[i][y] * fy
+			}
+		}
+		return s
+	}
+	ops, _, _ := gotoh(len(freqA), len(freqB), score, mode.GapOpen, mode.GapExtend, mode.FreeEndGaps, false)
+
+	merged := &profile{members: append(append([]int{}, a.members...), b.members...)}
+	for _, row := range a.rows {
+		merged.rows = append(merged.rows, applyOps(row, ops, opGapA))
+	}
+	for _, row := range b.rows {
+		merged.rows = append(merged.rows, applyOps(row, ops, opGapB))
+	}
+	return merged
+}
+
+// applyOps inserts gaps in row wherever the alignment path has the given
+// gap operation, and consumes a residue for every other operation.
+func applyOps(row []byte, ops []byte, gap byte) []byte {
+	aligned := make([]byte, 0, len(ops))
+	k := 0
+	for _, op := range ops {
+		if op == gap {
+			aligned = append(aligned, '-')
+		} else {
+			aligned = append(aligned, row[k])
+			k++
+		}
+	}
+	return aligned
+}
+
+// Operations of an alignment path.
+const (
+	// opMatch aligns a position of a with a position of b.
+	opMatch byte = iota
+	// opGapB aligns a position of a with a gap in b.
+	opGapB
+	// opGapA aligns a position of b with a gap in a.
+	opGapA
+	// opStart marks the start of a local alignment.
+	opStart
+)
+
+// gotoh aligns two sequences of length n and m with affine gap penalties
+// using Gotoh's algorithm, where score returns the score of aligning
+// position i of the first with position j of the second.
+// A gap of length k is penalized by open + (k-1)*extend.
+//
+// Returns the alignment path and the positions in each sequence where the
+// path starts. For global alignments the path covers both sequences
+// entirely and starts at 0. If freeEnds is true, gaps at either end are
+// not penalized. If local is true, the path only covers the best scoring
+// local alignment.
+//
+// The scores and traceback of the 3 operations are kept for every cell, in
+// 3 float64 and 3 byte slices of (n+1)(m+1) cells each.
+func gotoh(n, m int, score func(i, j int) float64, open, extend float64, freeEnds, local bool) ([]byte, int, int) {
+	negInf := math.Inf(-1)
+	width := m + 1
+	size := (n + 1) * width
+	// Score and traceback of paths ending in each operation
+	var scores [3][]float64
+	var trace [3][]byte
+	for op := range scores {
+		scores[op] = make([]float64, size)
+		trace[op] = make([]byte, size)
+		for k := range scores[op] {
+			scores[op][k] = negInf
+		}
+	}
+
+	// Gap penalties at either end are zero when end gaps are free
+	gapPenalty := func(atEnd bool, extending bool) float64 {
+		if freeEnds && atEnd {
+			return 0
+		}
+		if extending {
+			return extend
+		}
+		return open
+	}
+
+	if !local {
+		scores[opMatch][0] = 0
+		for i := 1; i <= n; i++ {
+			scores[opGapB][i*width] = -(gapPenalty(true, false) + float64(i-1)*gapPenalty(true, true))
+		}
+		for j := 1; j <= m; j++ {
+			scores[opGapA][j] = -(gapPenalty(true, false) + float64(j-1)*gapPenalty(true, true))
+		}
+	}
+
+	best, bestI, bestJ := negInf, 0, 0
+	for i := 1; i <= n; i++ {
+		for j := 1; j <= m; j++ {
+			k := i*width + j
+
+			// Match extends the best path ending at (i-1, j-1)
+			diag := k - width - 1
+			prev, prevOp := negInf, opStart
+			for _, op := range []byte{opMatch, opGapB, opGapA} {
+				if scores[op][diag] > prev {
+					prev, prevOp = scores[op][diag], op
+				}
+			}
+			if local && prev < 0 {
+				prev, prevOp = 0, opStart
+			}
+			scores[opMatch][k] = prev + score(i-1, j-1)
+			trace[opMatch][k] = prevOp
+
+			// Gap in b extends a path ending at (i-1, j)
+			up := k - width
+			atEnd := j == m
+			scores[opGapB][k], trace[opGapB][k] = scores[opMatch][up]-gapPenalty(atEnd, false), opMatch
+			if s := scores[opGapB][up] - gapPenalty(atEnd, true); s > scores[opGapB][k] {
+				scores[opGapB][k], trace[opGapB][k] = s, opGapB
+			}
+			if s := scores[opGapA][up] - gapPenalty(atEnd, false); s > scores[opGapB][k] {
+				scores[opGapB][k], trace[opGapB][k] = s, opGapA
+			}
+
+			// Gap in a extends a path ending at (i, j-1)
+			left := k - 1
+			atEnd = i == n
+			scores[opGapA][k], trace[opGapA][k] = scores[opMatch][left]-gapPenalty(atEnd, false), opMatch
+			if s := scores[opGapA][left] - gapPenalty(atEnd, true); s > scores[opGapA][k] {
+				scores[opGapA][k], trace[opGapA][k] = s, opGapA
+			}
+			if s := scores[opGapB][left] - gapPenalty(atEnd, false); s > scores[opGapA][k] {
+				scores[opGapA][k], trace[opGapA][k] = s, opGapB
+			}
+
+			if local && scores[opMatch][k] > best {
+				best, bestI, bestJ = scores[opMatch][k], i, j
+			}
+		}
+	}
+
+	// Traces back from the end of the best path
+	var ops []byte
+	i, j := n, m
+	state := opMatch
+	if local {
+		if best <= 0 {
+			return nil, 0, 0
+		}
+		i, j = bestI, bestJ
+	} else {
+		k := n*width + m
+		for _, op := range []byte{opGapB, opGapA} {
+			if scores[op][k] > scores[state][k] {
+				state = op
+			}
+		}
+	}
+	for i > 0 || j > 0 {
+		if !local && i == 0 {
+			state = opGapA
+		} else if !local && j == 0 {
+			state = opGapB
+		}
+		op := state
+		if i > 0 && j > 0 {
+			state = trace[op][i*width+j]
+		}
+		ops = append(ops, op)
+		switch op {
+		case opMatch:
+			i--
+			j--
+		case opGapB:
+			i--
+		case opGapA:
+			j--
+		}
+		if local && state == opStart {
+			break
+		}
+	}
+
+	// Reverses the path so that it starts from the beginning
+	for l, r := 0, len(ops)-1; l < r; l, r = l+1, r-1 {
+		ops[l], ops[r] = ops[r], ops[l]
+	}
+	return ops, i, j
+}
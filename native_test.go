@@ -0,0 +1,100 @@
+package conspos
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+// pairwise aligns a and b using gotoh and returns the aligned region of
+// each sequence.
+func pairwise(a, b string, mode NativeMode) (string, string) {
+	sub := nucleotideSubstitution()
+	x, y := sub.encode(a), sub.encode(b)
+	ops, i, j := gotoh(len(x), len(y), func(i, j int) float64 {
+		return sub.score(x[i], y[j])
+	}, mode.GapOpen, mode.GapExtend, mode.FreeEndGaps, mode.Local)
+	var alignedA, alignedB []byte
+	for _, op := range ops {
+		switch op {
+		case opMatch:
+			alignedA, alignedB = append(alignedA, a[i]), append(alignedB, b[j])
+			i++
+			j++
+		case opGapB:
+			alignedA, alignedB = append(alignedA, a[i]), append(alignedB, '-')
+			i++
+		case opGapA:
+			alignedA, alignedB = append(alignedA, '-'), append(alignedB, b[j])
+			j++
+		}
+	}
+	return string(alignedA), string(alignedB)
+}
+
+func TestGotoh(t *testing.T) {
+	global := NativeMode{GapOpen: 10, GapExtend: 1}
+	freeEnds := NativeMode{GapOpen: 10, GapExtend: 1, FreeEndGaps: true}
+	local := NativeMode{Local: true, GapOpen: 10, GapExtend: 1, FreeEndGaps: true}
+	tests := []struct {
+		name         string
+		a, b         string
+		mode         NativeMode
+		wantA, wantB string
+	}{
+		{"global identical", "ACGT", "ACGT", global, "ACGT", "ACGT"},
+		{"global insertion", "AAAACCCC", "AAAAGGGGCCCC", global, "AAAA----CCCC", "AAAAGGGGCCCC"},
+		{"global end gap", "ACGTACGT", "ACGTACG", global, "ACGTACGT", "ACGTACG-"},
+		{"free end gaps", "ACGTACGT", "TACG", freeEnds, "ACGTACGT", "---TACG-"},
+		{"local", "TTTTACGTACGTTTTT", "GGGACGTACGGGG", local, "ACGTACG", "ACGTACG"},
+		{"local without similarity", "AAAA", "CCCC", local, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotA, gotB := pairwise(tt.a, tt.b, tt.mode)
+			if gotA != tt.wantA || gotB != tt.wantB {
+				t.Errorf("gotoh aligned\n%s\n%s\nwant\n%s\n%s", gotA, gotB, tt.wantA, tt.wantB)
+			}
+		})
+	}
+}
+
+func TestGuideTree(t *testing.T) {
+	// Sequences 0 and 1 are the closest, followed by 2 and 3.
+	dist := [][]float64{
+		{0, 0.1, 0.8, 0.8},
+		{0.1, 0, 0.8, 0.8},
+		{0.8, 0.8, 0, 0.2},
+		{0.8, 0.8, 0.2, 0},
+	}
+	tree := guideTree(dist)
+	wantMerges := [][2]int{{0, 1}, {2, 3}, {0, 2}}
+	wantLengths := [][2]float64{{0.05, 0.05}, {0.1, 0.1}, {0.35, 0.3}}
+	if len(tree.Merges) != len(wantMerges) {
+		t.Fatalf("guideTree merges = %v, want %v", tree.Merges, wantMerges)
+	}
+	for k := range wantMerges {
+		if tree.Merges[k] != wantMerges[k] {
+			t.Errorf("guideTree merges = %v, want %v", tree.Merges, wantMerges)
+		}
+		for l := range wantLengths[k] {
+			if math.Abs(tree.Lengths[k][l]-wantLengths[k][l]) > 1e-9 {
+				t.Errorf("guideTree lengths = %v, want %v", tree.Lengths, wantLengths)
+			}
+		}
+	}
+}
+
+func TestProgressiveAlign(t *testing.T) {
+	seqs := []string{"AAAACCCC", "AAAAGGGGCCCC", "AAAAGGGGCCCC"}
+	want := []string{"AAAA----CCCC", "AAAAGGGGCCCC", "AAAAGGGGCCCC"}
+	got, err := progressiveAlign(context.Background(), seqs, nucleotideSubstitution(), NewNative().Modes["global"], 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("progressiveAlign = %q, want %q", got, want)
+		}
+	}
+}
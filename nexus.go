@@ -0,0 +1,135 @@
+package conspos
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	fa "github.com/kentwait/gofasta"
+)
+
+// NexusOptions sets how alignments are written in the NEXUS format.
+type NexusOptions struct {
+	// Interleaved writes the sequences in blocks of 60 sites. Otherwise,
+	// each sequence is written on a single line.
+	Interleaved bool
+}
+
+// NexusToBuffer writes the template alignment in the NEXUS format to the
+// buffer, as a DATA block followed by a SETS block that defines the
+// consistent sites as the character set "consistent" and the other sites
+// as "inconsistent", such that PAUP* and MrBayes can include or exclude
+// them. A character set without sites is not written. Returns an error if
+// sequence IDs are not unique.
+func NexusToBuffer(template fa.Alignment, consistentPos []bool, opts NexusOptions) (bytes.Buffer, error) {
+	var buffer bytes.Buffer
+	if err := checkUniqueIDs(template); err != nil {
+		return buffer, err
+	}
+	names := make([]string, len(template))
+	var width int
+	for i, s := range template {
+		names[i] = nexusName(s.ID())
+		if len(names[i]) > width {
+			width = len(names[i])
+		}
+	}
+	var length int
+	if len(template) > 0 {
+		length = len(template[0].Sequence())
+	}
+
+	buffer.WriteString("#NEXUS\n\n")
+	buffer.WriteString("BEGIN DATA;\n")
+	buffer.WriteString(fmt.Sprintf("\tDIMENSIONS NTAX=%d NCHAR=%d;\n", len(template), length))
+	format := fmt.Sprintf("DATATYPE=%s MISSING=? GAP=-", nexusDatatype(template))
+	if opts.Interleaved {
+		format += " INTERLEAVE"
+	}
+	buffer.WriteString("\tFORMAT " + format + ";\n")
+	buffer.WriteString("\tMATRIX\n")
+	blockLength := length
+	if opts.Interleaved {
+		blockLength = blockWidth
+	}
+	for start := 0; start < length; start += blockLength {
+		end := start + blockLength
+		if end > length {
+			end = length
+		}
+		if start > 0 {
+			buffer.WriteString("\n")
+		}
+		for i, s := range template {
+			buffer.WriteString(fmt.Sprintf("\t%-*s %s\n", width, names[i], s.Sequence()[start:end]))
+		}
+	}
+	buffer.WriteString("\t;\nEND;\n\n")
+
+	buffer.WriteString("BEGIN SETS;\n")
+	for _, charset := range []struct {
+		name       string
+		consistent bool
+	}{{"consistent", true}, {"inconsistent", false}} {
+		if ranges := siteRanges(consistentPos, charset.consistent); len(ranges) > 0 {
+			buffer.WriteString(fmt.Sprintf("\tCHARSET %s = %s;\n", charset.name, ranges))
+		}
+	}
+	buffer.WriteString("END;\n")
+	return buffer, nil
+}
+
+// nexusName returns the sequence ID as a NEXUS word, which is quoted if it
+// contains whitespace or punctuation.
+func nexusName(id string) string {
+	if len(id) > 0 && !strings.ContainsAny(id, " \t()[]{}/\\,;:=*'\"`+-<>") {
+		return id
+	}
+	return "'" + strings.Replace(id, "'", "''", -1) + "'"
+}
+
+// nexusDatatype returns "DNA" if the residues of the alignment are A, C, G,
+// T or IUPAC ambiguity codes, "RNA" if uracil is found instead of thymine,
+// and "PROTEIN" otherwise.
+func nexusDatatype(template fa.Alignment) string {
+	var thymine, uracil bool
+	for _, s := range template {
+		for _, c := range strings.ToUpper(s.Sequence()) {
+			switch c {
+			case 'T':
+				thymine = true
+			case 'U':
+				uracil = true
+			case 'A', 'C', 'G', 'R', 'Y', 'K', 'M', 'S', 'W', 'B', 'D', 'H', 'V', 'N', '-', '?':
+			default:
+				return "PROTEIN"
+			}
+		}
+	}
+	if uracil && !thymine {
+		return "RNA"
+	}
+	return "DNA"
+}
+
+// siteRanges returns the sites where pos is equal to value as ranges of
+// sites numbered from 1, such as "1-17 32 40-61".
+func siteRanges(pos []bool, value bool) string {
+	var ranges []string
+	for j := 0; j < len(pos); j++ {
+		if pos[j] != value {
+			continue
+		}
+		start := j
+		for j+1 < len(pos) && pos[j+1] == value {
+			j++
+		}
+		if start == j {
+			ranges = append(ranges, strconv.Itoa(start+1))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", start+1, j+1))
+		}
+	}
+	return strings.Join(ranges, " ")
+}
@@ -0,0 +1,85 @@
+package conspos_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kentwait/conspos"
+	fa "github.com/kentwait/gofasta"
+)
+
+func TestNexusToBuffer(t *testing.T) {
+	aln := fa.FastaToAlignment(strings.NewReader(">a\nMKV-L\n>seq-2\nMKVIL\n"), false)
+	buffer, err := conspos.NexusToBuffer(aln, []bool{true, true, false, true, false}, conspos.NexusOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "#NEXUS\n\n" +
+		"BEGIN DATA;\n" +
+		"\tDIMENSIONS NTAX=2 NCHAR=5;\n" +
+		"\tFORMAT DATATYPE=PROTEIN MISSING=? GAP=-;\n" +
+		"\tMATRIX\n" +
+		"\ta       MKV-L\n" +
+		"\t'seq-2' MKVIL\n" +
+		"\t;\nEND;\n\n" +
+		"BEGIN SETS;\n" +
+		"\tCHARSET consistent = 1-2 4;\n" +
+		"\tCHARSET inconsistent = 3 5;\n" +
+		"END;\n"
+	if got := buffer.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// Without inconsistent sites, only the consistent character set is defined.
+	buffer, err = conspos.NexusToBuffer(aln, []bool{true, true, true, true, true}, conspos.NexusOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buffer.String(); strings.Contains(got, "inconsistent") || !strings.Contains(got, "CHARSET consistent = 1-5;") {
+		t.Errorf("character sets of a consistent alignment:\n%s", got)
+	}
+
+	duplicated := fa.FastaToAlignment(strings.NewReader(">a\nAC\n>a\nAC\n"), false)
+	if _, err := conspos.NexusToBuffer(duplicated, []bool{true, true}, conspos.NexusOptions{}); err == nil {
+		t.Error("NEXUS of duplicated IDs did not return an error")
+	}
+}
+
+func TestNexusDatatype(t *testing.T) {
+	tests := []struct {
+		name  string
+		fasta string
+		want  string
+	}{
+		{"dna", ">a\nACGT-\n>b\nACGTN\n", "DNA"},
+		{"dna with ambiguity codes", ">a\nACGTRYKMSW\n>b\nACGTBDHVN?\n", "DNA"},
+		{"rna", ">a\nACGU\n>b\nACGR\n", "RNA"},
+		{"protein", ">a\nMKV-L\n>b\nMKVIL\n", "PROTEIN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aln := fa.FastaToAlignment(strings.NewReader(tt.fasta), false)
+			buffer, err := conspos.NexusToBuffer(aln, make([]bool, len(aln[0].Sequence())), conspos.NexusOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "DATATYPE=" + tt.want + " "; !strings.Contains(buffer.String(), want) {
+				t.Errorf("got\n%s\nwant %s", buffer.String(), want)
+			}
+		})
+	}
+}
+
+func TestRunNexusGolden(t *testing.T) {
+	res, err := conspos.Run(context.Background(), filepath.Join("testdata", "examples", "inconsistent.fa"), fakeOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer, err := conspos.NexusToBuffer(res.TemplateAlignment(), res.ConsistentPos, conspos.NexusOptions{Interleaved: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "inconsistent.nex", buffer.String())
+}
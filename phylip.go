@@ -0,0 +1,96 @@
+package conspos
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	fa "github.com/kentwait/gofasta"
+)
+
+// phylipNameWidth is the width of sequence names in strict PHYLIP.
+const phylipNameWidth = 10
+
+// PhylipOptions sets the variant of the PHYLIP format.
+type PhylipOptions struct {
+	// Strict truncates sequence IDs to 10 characters and pads them with
+	// spaces, as read by the original PHYLIP programs. Otherwise, IDs are
+	// written in full followed by spaces, as read by RAxML and PhyML.
+	Strict bool
+	// Interleaved writes the sequences in blocks of 60 sites. Otherwise,
+	// each sequence is written on a single line.
+	Interleaved bool
+}
+
+// PhylipToBuffer writes the template alignment in the PHYLIP format to
+// the buffer. The marker sequence cannot be written in PHYLIP. Returns an
+// error if sequence IDs are not unique, which in strict PHYLIP includes
+// IDs that are the same after truncation.
+func PhylipToBuffer(template fa.Alignment, opts PhylipOptions) (bytes.Buffer, error) {
+	var buffer bytes.Buffer
+	names, err := phylipNames(template, opts.Strict)
+	if err != nil {
+		return buffer, err
+	}
+	var length int
+	if len(template) > 0 {
+		length = len(template[0].Sequence())
+	}
+	buffer.WriteString(fmt.Sprintf("%d %d\n", len(template), length))
+
+	width := length
+	if opts.Interleaved {
+		width = blockWidth
+	}
+	for start := 0; start < length; start += width {
+		end := start + width
+		if end > length {
+			end = length
+		}
+		if start > 0 {
+			buffer.WriteString("\n")
+		}
+		for i, s := range template {
+			// Later blocks are indented in place of the names.
+			if start == 0 {
+				buffer.WriteString(names[i])
+			} else {
+				buffer.WriteString(strings.Repeat(" ", len(names[i])))
+			}
+			buffer.WriteString(s.Sequence()[start:end] + "\n")
+		}
+	}
+	return buffer, nil
+}
+
+// phylipNames returns the sequence IDs of the alignment as they are
+// written in PHYLIP, padded to the same width.
+func phylipNames(template fa.Alignment, strict bool) ([]string, error) {
+	if err := checkUniqueIDs(template); err != nil {
+		return nil, err
+	}
+	width := phylipNameWidth
+	if !strict {
+		// Relaxed names are separated from the sequence by at least one space.
+		width = 0
+		for _, s := range template {
+			if len(s.ID()) >= width {
+				width = len(s.ID()) + 1
+			}
+		}
+	}
+	names := make([]string, len(template))
+	seen := make(map[string]string)
+	for i, s := range template {
+		name := s.ID()
+		if len(name) > width {
+			name = name[:width]
+		}
+		if id, ok := seen[name]; ok {
+			return nil, fmt.Errorf("sequence IDs %s and %s are both truncated to %s in strict PHYLIP", id, s.ID(), name)
+		}
+		seen[name] = s.ID()
+		names[i] = name + strings.Repeat(" ", width-len(name))
+	}
+	return names, nil
+}
@@ -0,0 +1,73 @@
+package conspos_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kentwait/conspos"
+	fa "github.com/kentwait/gofasta"
+)
+
+func TestPhylipToBuffer(t *testing.T) {
+	aln := fa.FastaToAlignment(strings.NewReader(">a\nACGT-\n>long_name_x\nAC-TT\n"), false)
+	tests := []struct {
+		name string
+		opts conspos.PhylipOptions
+		want string
+	}{
+		{"relaxed", conspos.PhylipOptions{}, "2 5\na           ACGT-\nlong_name_x AC-TT\n"},
+		{"strict", conspos.PhylipOptions{Strict: true}, "2 5\na         ACGT-\nlong_name_AC-TT\n"},
+	}
+	for _, tt := range tests {
+		buffer, err := conspos.PhylipToBuffer(aln, tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := buffer.String(); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+
+	long := fa.FastaToAlignment(strings.NewReader(">a\n"+strings.Repeat("A", 70)+"\n>sequence_1\n"+strings.Repeat("C", 70)+"\n"), false)
+	buffer, err := conspos.PhylipToBuffer(long, conspos.PhylipOptions{Strict: true, Interleaved: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "2 70\n" +
+		"a         " + strings.Repeat("A", 60) + "\n" +
+		"sequence_1" + strings.Repeat("C", 60) + "\n" +
+		"\n" +
+		"          AAAAAAAAAA\n" +
+		"          CCCCCCCCCC\n"
+	if got := buffer.String(); got != want {
+		t.Errorf("strict interleaved: got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPhylipToBufferCollisions(t *testing.T) {
+	truncated := fa.FastaToAlignment(strings.NewReader(">sequence_10\nAC\n>sequence_11\nAC\n"), false)
+	if _, err := conspos.PhylipToBuffer(truncated, conspos.PhylipOptions{Strict: true}); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("strict PHYLIP of IDs that collide after truncation: error = %v", err)
+	}
+	if _, err := conspos.PhylipToBuffer(truncated, conspos.PhylipOptions{}); err != nil {
+		t.Errorf("relaxed PHYLIP of long IDs: %v", err)
+	}
+	duplicated := fa.FastaToAlignment(strings.NewReader(">a\nAC\n>a\nAC\n"), false)
+	if _, err := conspos.PhylipToBuffer(duplicated, conspos.PhylipOptions{}); err == nil {
+		t.Error("relaxed PHYLIP of duplicated IDs did not return an error")
+	}
+}
+
+func TestRunPhylipGolden(t *testing.T) {
+	res, err := conspos.Run(context.Background(), filepath.Join("testdata", "examples", "inconsistent.fa"), fakeOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer, err := conspos.PhylipToBuffer(res.TemplateAlignment(), conspos.PhylipOptions{Interleaved: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "inconsistent.phy", buffer.String())
+}
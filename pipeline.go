@@ -1,17 +1,24 @@
-package main
+package conspos
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"os"
+	"io/ioutil"
+	"math"
+	"math/rand"
 	"strconv"
 	"strings"
+	"sync"
 
 	fa "github.com/kentwait/gofasta"
 )
 
 // ConsistentAlignmentPositions returns the list of positions in the alignment that are considered consistent given by the alignment pattern per site across all given alignments.
-func ConsistentAlignmentPositions(gapChar string, matrices ...[][]int) []bool {
+// Gaps are the negative values of the matrices returned by UngappedPositionMatrix, and must be at the same sequences for patterns to match.
+// Use ConsistencyScoresIgnoringGaps to only compare residues.
+func ConsistentAlignmentPositions(matrices ...[][]int) []bool {
 	// Transpose matrices and combine as string
 	patternSetMap := make(map[string]int)
 	var templatePattern []string
@@ -122,144 +129,614 @@ func ConsistentAlignmentPositions(gapChar string, matrices ...[][]int) []bool {
 }
 
 // ConsistentCodonAlignmentPositions returns the list of positions in the codon alignment that are considered consistent given by the alignment pattern per site across all given alignments.
-func ConsistentCodonAlignmentPositions(gapChar string, matrices ...[][]int) []bool {
+func ConsistentCodonAlignmentPositions(matrices ...[][]int) []bool {
 	// ConsistentAlignmentPositions constructs a boolean slice for the codon matrices
 	var codonPos []bool
-	for _, pos := range ConsistentAlignmentPositions(gapChar, matrices...) {
+	for _, pos := range ConsistentAlignmentPositions(matrices...) {
 		// Added 3 times to because each codon has 3 nucleotide sites
 		codonPos = append(codonPos, pos, pos, pos)
 	}
 	return codonPos
 }
 
-// ConsistentAlnPipeline aligns using global, local, and affine-local alignment strategies to determine positions that have a consistent alignment pattern over the three different strategies.
-func ConsistentAlnPipeline(inputPath, gapChar, markerID, consistentMarker, inconsistentMarker string, iterations int, toUpper, toLower, saveTempAlns bool) bytes.Buffer {
-	// TODO: Allow this to be a parameter instead of being hard-coded
-	const mafftCmd = "mafft"
+// ConsistencyScores returns the consistency score of each position in the alignment given by the first matrix, the template.
+// The score is the fraction of alignments, including the template, that have the same alignment pattern as the template at that position.
+// Positions with a score of 1 are the consistent positions returned by ConsistentAlignmentPositions.
+func ConsistencyScores(matrices ...[][]int) []float64 {
+	// Alignment patterns are encoded as strings like in ConsistentAlignmentPositions.
+	// Each pattern is counted once per matrix.
+	patternCount := make(map[string]int)
+	var templatePattern []string
+	for k, matrix := range matrices {
+		patterns := columnPatterns(matrix)
+		if k == 0 {
+			templatePattern = patterns
+		}
+		seen := make(map[string]bool)
+		for _, pattern := range patterns {
+			if !seen[pattern] {
+				patternCount[pattern]++
+				seen[pattern] = true
+			}
+		}
+	}
+
+	scores := make([]float64, len(templatePattern))
+	for j, pattern := range templatePattern {
+		scores[j] = float64(patternCount[pattern]) / float64(len(matrices))
+	}
+	return scores
+}
 
-	os.Stderr.WriteString(fmt.Sprintf("%s: ", inputPath))
+// ConsistencyCodonScores returns the consistency score of each position in the codon alignment. Each codon score is repeated for its 3 nucleotide sites.
+func ConsistencyCodonScores(matrices ...[][]int) []float64 {
+	return repeatCodon(ConsistencyScores(matrices...))
+}
 
-	/* Align using 3 different strategies implemented in MAFFT
-	   - global alignment (GinsiAlign)
-	   - local alignment (LinsiAlign)
-	   - affine-gap local alignment (EinsiAlign)
+// ConsistencyScoresIgnoringGaps returns the consistency score of each position in the alignment given by the first matrix, the template, ignoring the sequences that have a gap at that position in the template.
+// The score is the fraction of alignments, including the template, where the residues at that position in the template are aligned together, regardless of the other sequences.
+func ConsistencyScoresIgnoringGaps(matrices ...[][]int) []float64 {
+	template := matrices[0]
+	// columns[k][i][p] is the position of residue p of sequence i in the other alignment k.
+	columns := make([][][]int, len(matrices)-1)
+	for k, matrix := range matrices[1:] {
+		columns[k] = residuePositions(matrix)
+	}
 
-	   These calls run sequentially with MAFFT saturating all cores.
-	   MAFFT outputs results to stdout and these functions capture stdout to return a string.
-	*/
-	// TODO: Propagate ExecMafft error into *Align
-	// TODO: *Align should probably output a buffer instead of a string
-	ginsiString := CharAlign(mafftCmd, inputPath, "ginsi", iterations)
-	linsiString := CharAlign(mafftCmd, inputPath, "linsi", iterations)
-	einsiString := CharAlign(mafftCmd, inputPath, "einsi", iterations)
+	scores := make([]float64, len(template[0]))
+	for j := range scores {
+		// The template always agrees with itself.
+		agree := 1
+		for _, c := range columns {
+			column, aligned := -1, true
+			for i := range template {
+				p := template[i][j]
+				if p < 0 {
+					continue
+				}
+				if column < 0 {
+					column = c[i][p]
+				} else if c[i][p] != column {
+					aligned = false
+					break
+				}
+			}
+			if aligned {
+				agree++
+			}
+		}
+		scores[j] = float64(agree) / float64(len(matrices))
+	}
+	return scores
+}
+
+// ConsistencyCodonScoresIgnoringGaps returns the consistency score of each position in the codon alignment ignoring gapped sequences. Each codon score is repeated for its 3 nucleotide sites.
+func ConsistencyCodonScoresIgnoringGaps(matrices ...[][]int) []float64 {
+	return repeatCodon(ConsistencyScoresIgnoringGaps(matrices...))
+}
 
-	// Check if alignments are not empty.
-	// If empty, print error message to stderr and exit with code 1
-	if len(ginsiString) == 0 {
-		EmptyAlnError("G-INSI", inputPath)
+// GapFractions returns the fraction of sequences that have a gap at each position of the alignment given by the ungapped position matrix.
+func GapFractions(matrix [][]int) []float64 {
+	if len(matrix) == 0 {
+		return nil
 	}
-	if len(linsiString) == 0 {
-		EmptyAlnError("L-INSI", inputPath)
+	fractions := make([]float64, len(matrix[0]))
+	for j := range fractions {
+		var gaps int
+		for i := range matrix {
+			if matrix[i][j] < 0 {
+				gaps++
+			}
+		}
+		fractions[j] = float64(gaps) / float64(len(matrix))
 	}
-	if len(einsiString) == 0 {
-		EmptyAlnError("E-INSI", inputPath)
+	return fractions
+}
+
+// ResiduePairScores returns the residue-pair consistency score of each position in the alignment given by the first matrix, the template.
+// The score is the fraction of pairs of residues aligned at that position in the template that are also aligned in the other alignments, averaged over the other alignments.
+// Positions with fewer than two residues, or without other alignments to compare with, have a score of 1.
+func ResiduePairScores(matrices ...[][]int) []float64 {
+	partners, reproduced := residuePairCounts(matrices)
+	others := len(matrices) - 1
+
+	// Each pair is counted for both of its residues, which does not change the fraction.
+	scores := make([]float64, len(matrices[0][0]))
+	for j := range scores {
+		var pairs, pairsReproduced int
+		for i := range partners {
+			pairs += partners[i][j]
+			pairsReproduced += reproduced[i][j]
+		}
+		scores[j] = pairFraction(pairs, pairsReproduced, others)
 	}
+	return scores
+}
 
-	// Each result (string) is parsed to create character alignments
-	ginsiAln := fa.FastaToAlignment(strings.NewReader(ginsiString), false)
-	linsiAln := fa.FastaToAlignment(strings.NewReader(linsiString), false)
-	einsiAln := fa.FastaToAlignment(strings.NewReader(einsiString), false)
-	os.Stderr.WriteString(".")
+// ResiduePairCodonScores returns the residue-pair consistency score of each position in the codon alignment. Each codon score is repeated for its 3 nucleotide sites.
+func ResiduePairCodonScores(matrices ...[][]int) []float64 {
+	return repeatCodon(ResiduePairScores(matrices...))
+}
 
-	// Writes temp alignments if necessary
-	// TODO: ToFasta is not necessary, just write the ginsiString, linsiString, einsiString
-	if saveTempAlns == true {
-		einsiAln.ToFastaFile(inputPath + ".einsi.aln")
-		ginsiAln.ToFastaFile(inputPath + ".ginsi.aln")
-		linsiAln.ToFastaFile(inputPath + ".linsi.aln")
+// ResidueScores returns the consistency score of each residue in the alignment given by the first matrix, the template.
+// The score of a residue is the fraction of residues aligned with it in the template that are also aligned with it in the other alignments, averaged over the other alignments.
+// Residues that are not aligned with any other residue, or without other alignments to compare with, have a score of 1. Gaps have a score of -1.
+func ResidueScores(matrices ...[][]int) [][]float64 {
+	partners, reproduced := residuePairCounts(matrices)
+	others := len(matrices) - 1
+
+	scores := make([][]float64, len(partners))
+	for i := range partners {
+		scores[i] = make([]float64, len(partners[i]))
+		for j := range partners[i] {
+			if matrices[0][i][j] < 0 {
+				scores[i][j] = -1
+				continue
+			}
+			scores[i][j] = pairFraction(partners[i][j], reproduced[i][j], others)
+		}
 	}
+	return scores
+}
 
-	// consistentPos is a boolean slice indicating per position whether it is consistent or not.
-	consistentPos := ConsistentAlignmentPositions(
-		gapChar,
-		einsiAln.UngappedPositionMatrix(gapChar),
-		ginsiAln.UngappedPositionMatrix(gapChar),
-		linsiAln.UngappedPositionMatrix(gapChar),
-	)
-	os.Stderr.WriteString(".")
+// ResidueCodonScores returns the consistency score of each codon in the codon alignment. Each codon score is repeated for its 3 nucleotides.
+func ResidueCodonScores(matrices ...[][]int) [][]float64 {
+	scores := ResidueScores(matrices...)
+	for i, row := range scores {
+		scores[i] = repeatCodon(row)
+	}
+	return scores
+}
 
-	if toUpper == true {
-		einsiAln.ToUpper()
-	} else if toLower == true {
-		einsiAln.ToLower()
+// repeatCodon returns the score of each codon repeated for its 3 nucleotide sites.
+func repeatCodon(scores []float64) []float64 {
+	var codonScores []float64
+	for _, score := range scores {
+		codonScores = append(codonScores, score, score, score)
 	}
+	return codonScores
+}
 
-	os.Stderr.WriteString(" Done.\n")
+// residuePairCounts counts for each residue in the template, the first matrix, the number of residues aligned with it and the number of times these pairs are also aligned in the other matrices.
+func residuePairCounts(matrices [][][]int) (partners, reproduced [][]int) {
+	template := matrices[0]
+	// columns[k][i][p] is the position of residue p of sequence i in the other alignment k.
+	columns := make([][][]int, len(matrices)-1)
+	for k, matrix := range matrices[1:] {
+		columns[k] = residuePositions(matrix)
+	}
 
-	// TODO: Add aiblity to select what alignment is outputted
-	return MarkedAlignmentToBuffer(einsiAln, consistentPos, markerID, consistentMarker, inconsistentMarker)
+	partners = make([][]int, len(template))
+	reproduced = make([][]int, len(template))
+	for i := range template {
+		partners[i] = make([]int, len(template[i]))
+		reproduced[i] = make([]int, len(template[i]))
+	}
+	for j := range template[0] {
+		for a := 0; a < len(template); a++ {
+			pa := template[a][j]
+			if pa < 0 {
+				continue
+			}
+			for b := a + 1; b < len(template); b++ {
+				pb := template[b][j]
+				if pb < 0 {
+					continue
+				}
+				// Residues pa and pb are aligned in the template. Checks whether they are also aligned in each of the other alignments.
+				partners[a][j]++
+				partners[b][j]++
+				for _, c := range columns {
+					if c[a][pa] == c[b][pb] {
+						reproduced[a][j]++
+						reproduced[b][j]++
+					}
+				}
+			}
+		}
+	}
+	return partners, reproduced
 }
 
-// ConsistentCodonAlnPipeline aligns codon sequences using global, local, and  affine-local alignment strategies to determine positions that have a consistent alignment pattern over the three different strategies.
-func ConsistentCodonAlnPipeline(inputPath, gapChar, markerID, consistentMarker, inconsistentMarker string, iterations int, toUpper, toLower, saveTempAlns bool) bytes.Buffer {
-	// TODO: Allow this to be a parameter instead of being hard-coded
-	const mafftCmd = "mafft"
+// pairFraction returns the fraction of pairs reproduced by the other alignments, or 1 if there is nothing to compare.
+func pairFraction(pairs, reproduced, others int) float64 {
+	if pairs == 0 || others == 0 {
+		return 1
+	}
+	return float64(reproduced) / float64(pairs*others)
+}
 
-	os.Stderr.WriteString(fmt.Sprintf("%s: ", inputPath))
+// residuePositions inverts an ungapped position matrix such that the value at [i][p] is the position of residue p of sequence i in the alignment.
+func residuePositions(matrix [][]int) [][]int {
+	positions := make([][]int, len(matrix))
+	for i, row := range matrix {
+		for j, p := range row {
+			if p >= 0 {
+				positions[i] = append(positions[i], j)
+			}
+		}
+	}
+	return positions
+}
 
-	// Create an Alignment of CodonSequence to generate translated protein sequence from nucleotide sequence
-	c := fa.FastaFileToCodonAlignment(inputPath)
+// columnPatterns encodes the alignment pattern of each column of an ungapped position matrix as a string.
+func columnPatterns(matrix [][]int) []string {
+	if len(matrix) == 0 {
+		return nil
+	}
+	var patternBuffer bytes.Buffer
+	patterns := make([]string, len(matrix[0]))
+	for j := range patterns {
+		for i := 0; i < len(matrix); i++ {
+			patternBuffer.WriteString(strconv.Itoa(matrix[i][j]) + ",")
+		}
+		patterns[j] = patternBuffer.String()
+		patternBuffer.Reset()
+	}
+	return patterns
+}
+
+// ConsistentAlnPipeline aligns using each alignment strategy to determine positions that have a consistent alignment pattern over all the strategies.
+// For MAFFT, the default strategies are global, local, and affine-local alignment.
+func ConsistentAlnPipeline(ctx context.Context, inputPath string, opts Options) (Result, error) {
+	opts.progress(fmt.Sprintf("%s: ", inputPath))
+	ctx, cancel := opts.fileContext(ctx)
+	defer cancel()
+
+	// The input is read once and passed to each strategy through a new reader.
+	input, err := readInput(inputPath, false)
+	if err != nil {
+		return opts.failed(err)
+	}
+
+	/* Align using the given strategies, or the default strategies of the aligner. For MAFFT, these are
+	   - global alignment (G-INSI)
+	   - local alignment (L-INSI)
+	   - affine-gap local alignment (E-INSI)
 
-	// Read protein sequences from Alignment of CodonSequences and create a Fasta string in buffer
-	protReader := strings.NewReader(c.ToFasta())
+	   Strategies run concurrently and share the thread budget set in opts.
+	*/
+	aligner := opts.aligner()
+	strategies := opts.strategies(aligner)
+	if err := opts.checkTemplate(strategies); err != nil {
+		return opts.failed(err)
+	}
+	align := func(ctx context.Context, a Aligner, strategy string, threads int) (fa.Alignment, error) {
+		return a.Align(ctx, bytes.NewReader(input), strategy, threads)
+	}
+	alns, err := alignStrategies(ctx, inputPath, strategies, opts, func(ctx context.Context, strategy string, threads int) (fa.Alignment, error) {
+		return align(ctx, aligner, strategy, threads)
+	})
+	if err != nil {
+		return opts.failed(err)
+	}
+	template := opts.template(strategies, alns, false)
+	replicates, err := alignReplicates(ctx, inputPath, template, alns, opts, align)
+	if err != nil {
+		return opts.failed(err)
+	}
+
+	return consistentResult(inputPath, strategies, template, alns, replicates, opts, false), nil
+}
 
-	// Pass buff to each of the three alignment strategies.
-	// These will align protein sequences in MAFFT.
+// ConsistentCodonAlnPipeline aligns codon sequences using each alignment strategy to determine positions that have a consistent alignment pattern over all the strategies.
+func ConsistentCodonAlnPipeline(ctx context.Context, inputPath string, opts Options) (Result, error) {
+	opts.progress(fmt.Sprintf("%s: ", inputPath))
+	ctx, cancel := opts.fileContext(ctx)
+	defer cancel()
+
+	input, err := readInput(inputPath, true)
+	if err != nil {
+		return opts.failed(err)
+	}
+	// Create an Alignment of CodonSequence to generate translated protein sequence from nucleotide sequence
+	c := fa.FastaToAlignment(bytes.NewReader(input), true)
+
+	// The aligner will align the protein sequences.
 	// Based on the protein alignment, the original codon alignment is adjusted using the AlignCodonsUsingProtAlignment function.
-	ginsiString := CodonAlignStdin(mafftCmd, protReader, "ginsi", iterations, c)
-	linsiString := CodonAlignStdin(mafftCmd, protReader, "linsi", iterations, c)
-	einsiString := CodonAlignStdin(mafftCmd, protReader, "einsi", iterations, c)
+	aligner := opts.aligner()
+	strategies := opts.strategies(aligner)
+	if err := opts.checkTemplate(strategies); err != nil {
+		return opts.failed(err)
+	}
+	align := func(ctx context.Context, a Aligner, strategy string, threads int) (fa.Alignment, error) {
+		aln, err := CodonAlign(ctx, a, c, strategy, threads)
+		opts.progress("C")
+		return aln, err
+	}
+	alns, err := alignStrategies(ctx, inputPath, strategies, opts, func(ctx context.Context, strategy string, threads int) (fa.Alignment, error) {
+		return align(ctx, aligner, strategy, threads)
+	})
+	if err != nil {
+		return opts.failed(err)
+	}
+	template := opts.template(strategies, alns, true)
+	replicates, err := alignReplicates(ctx, inputPath, template, alns, opts, align)
+	if err != nil {
+		return opts.failed(err)
+	}
+
+	// Length of consistentPos is the length of the codon alignment as single characters.
+	return consistentResult(inputPath, strategies, template, alns, replicates, opts, true), nil
+}
+
+// readInput reads the FASTA file at inputPath and checks that it contains
+// sequences that can be aligned. If codon is true, sequence lengths must be
+// multiples of 3.
+func readInput(inputPath string, codon bool) ([]byte, error) {
+	input, err := ioutil.ReadFile(inputPath)
+	if err != nil {
+		return nil, &InvalidInputError{InputPath: inputPath, Err: err}
+	}
+	seqs := fa.FastaToAlignment(bytes.NewReader(input), false)
+	if len(seqs) == 0 {
+		return nil, &InvalidInputError{InputPath: inputPath, Err: errors.New("no sequences found")}
+	}
+	if codon {
+		for _, s := range seqs {
+			if len(s.Sequence())%3 != 0 {
+				return nil, &InvalidInputError{InputPath: inputPath, Err: fmt.Errorf("length of %s is not a multiple of 3", s.ID())}
+			}
+		}
+	}
+	return input, nil
+}
+
+// alignStrategies calls align for each strategy and returns the resulting
+// alignments keyed by strategy. Each call is given at most opts.Timeout to
+// finish.
+//
+// Up to opts.Concurrency strategies run at the same time, and the thread
+// budget of opts is divided equally between them. When a strategy fails,
+// the running strategies are stopped and the first error is returned.
+func alignStrategies(ctx context.Context, inputPath string, strategies []string, opts Options, align func(ctx context.Context, strategy string, threads int) (fa.Alignment, error)) (map[string]fa.Alignment, error) {
+	slots := opts.concurrency(len(strategies))
+	threads := opts.threads() / slots
+	if threads < 1 {
+		threads = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	alns := make(map[string]fa.Alignment)
+	sem := make(chan struct{}, slots)
+	for _, strategy := range strategies {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(strategy string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if ctx.Err() != nil {
+				// The strategy is not run, but the context is checked
+				// because it may have been cancelled by the caller
+				// rather than by a failed strategy.
+				mu.Lock()
+				defer mu.Unlock()
+				if firstErr == nil {
+					firstErr = contextError(ctx, inputPath, strategy, opts)
+				}
+				return
+			}
+
+			// Indicates the strategy being run by its first letter
+			opts.progress(strings.ToUpper(strategy[:1]))
+
+			aln, err := alignWithTimeout(ctx, inputPath, strategy, opts, func(ctx context.Context, strategy string) (fa.Alignment, error) {
+				return align(ctx, strategy, threads)
+			})
+			// Check if alignment is not empty.
+			if err == nil && len(aln) == 0 {
+				err = &EmptyAlignmentError{Strategy: strategy, InputPath: inputPath}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				// Only the first error is kept because the others are caused by cancelling.
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				return
+			}
+			alns[strategy] = aln
+		}(strategy)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	for _, strategy := range strategies {
+		if _, ok := alns[strategy]; !ok {
+			return nil, &StrategyError{Strategy: strategy, InputPath: inputPath, Err: errors.New("no alignment was made")}
+		}
+	}
+	opts.progress(".")
+
+	// Writes temp alignments if necessary
+	if opts.SaveTempAlignments == true {
+		for _, strategy := range strategies {
+			alns[strategy].ToFastaFile(inputPath + "." + strategy + ".aln")
+		}
+	}
+	return alns, nil
+}
 
-	// Check if string alignment is not empty
-	if len(ginsiString) == 0 {
-		EmptyAlnError("G-INSI", inputPath)
+// alignReplicates aligns the bootstrap replicates set in opts, each
+// following a guide tree built from bootstrapped sites of the template
+// alignment. Replicates are run like strategies named "bootstrap1",
+// "bootstrap2" and so on. Returns nil if no replicates are set.
+func alignReplicates(ctx context.Context, inputPath, template string, alns map[string]fa.Alignment, opts Options, align func(ctx context.Context, a Aligner, strategy string, threads int) (fa.Alignment, error)) ([]fa.Alignment, error) {
+	if opts.Bootstrap.Replicates <= 0 {
+		return nil, nil
 	}
-	if len(linsiString) == 0 {
-		EmptyAlnError("L-INSI", inputPath)
+	strategy := opts.Bootstrap.Strategy
+	if len(strategy) == 0 {
+		strategy = strings.TrimPrefix(template, ReversePrefix)
 	}
-	if len(einsiString) == 0 {
-		EmptyAlnError("E-INSI", inputPath)
+	treeAligner, ok := opts.treeAligner()
+	if !ok {
+		return nil, &StrategyError{Strategy: strategy, InputPath: inputPath, Err: fmt.Errorf("%s cannot align using a given guide tree", opts.aligner().Name())}
 	}
 
-	// The FASTA outputs are parsed to create codon alignments.
-	ginsiAln := fa.FastaToAlignment(strings.NewReader(ginsiString), true)
-	linsiAln := fa.FastaToAlignment(strings.NewReader(linsiString), true)
-	einsiAln := fa.FastaToAlignment(strings.NewReader(einsiString), true)
-	os.Stderr.WriteString(".")
+	// Trees are built before aligning so that they only depend on the seed.
+	rng := rand.New(rand.NewSource(opts.Bootstrap.Seed))
+	names := make([]string, opts.Bootstrap.Replicates)
+	trees := make(map[string]GuideTree)
+	for k := range names {
+		names[k] = "bootstrap" + strconv.Itoa(k+1)
+		trees[names[k]] = BootstrapTree(alns[template], rng)
+	}
+	replicateAlns, err := alignStrategies(ctx, inputPath, names, opts, func(ctx context.Context, name string, threads int) (fa.Alignment, error) {
+		return align(ctx, fixedTreeAligner{treeAligner, trees[name]}, strategy, threads)
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	// TODO: ToFasta conversion is unnecessary.
-	// *insiString is already in FASTA format
-	if saveTempAlns == true {
-		einsiAln.ToFastaFile(inputPath + ".einsi.aln")
-		ginsiAln.ToFastaFile(inputPath + ".ginsi.aln")
-		linsiAln.ToFastaFile(inputPath + ".linsi.aln")
+	replicates := make([]fa.Alignment, len(names))
+	for k, name := range names {
+		replicates[k] = replicateAlns[name]
 	}
+	return replicates, nil
+}
 
-	// consistentPos is a boolean slice indicating per position whether it is consistent or not. Length of consistentPos is the length of the codon alignment as single characters.
-	consistentPos := ConsistentCodonAlignmentPositions(
-		gapChar,
-		einsiAln.UngappedPositionMatrix(gapChar),
-		ginsiAln.UngappedPositionMatrix(gapChar),
-		linsiAln.UngappedPositionMatrix(gapChar),
-	)
+// alignWithTimeout calls align for the strategy within the time limit of
+// the strategy and of ctx. Returns *TimeoutError if either is exceeded, and
+// *StrategyError if align fails.
+func alignWithTimeout(ctx context.Context, inputPath, strategy string, opts Options, align func(ctx context.Context, strategy string) (fa.Alignment, error)) (fa.Alignment, error) {
+	strategyCtx, cancel := ctx, context.CancelFunc(func() {})
+	if opts.Timeout > 0 {
+		strategyCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	}
+	defer cancel()
+
+	aln, err := align(strategyCtx, strategy)
+	switch {
+	case err == nil:
+		return aln, nil
+	case ctx.Err() != nil:
+		return nil, contextError(ctx, inputPath, strategy, opts)
+	case strategyCtx.Err() == context.DeadlineExceeded:
+		return nil, &TimeoutError{Strategy: strategy, InputPath: inputPath, Timeout: opts.Timeout}
+	default:
+		return nil, &StrategyError{Strategy: strategy, InputPath: inputPath, Err: err}
+	}
+}
 
-	if toUpper == true {
-		einsiAln.ToUpper()
-	} else if toLower == true {
-		einsiAln.ToLower()
+// contextError returns the error of a strategy stopped because ctx is done:
+// a *TimeoutError if the time limit of the file was exceeded, or a
+// *StrategyError wrapping the error of ctx if it was cancelled.
+func contextError(ctx context.Context, inputPath, strategy string, opts Options) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return &TimeoutError{Strategy: strategy, InputPath: inputPath, Timeout: opts.FileTimeout, PerFile: true}
 	}
+	return &StrategyError{Strategy: strategy, InputPath: inputPath, Err: ctx.Err()}
+}
 
-	os.Stderr.WriteString(" Done.\n")
+// consistentResult computes the consistency scores of the alignments
+// compared with the alignment of the template strategy, and the consistent positions
+// given the metric and quorum of opts, and returns the Result. If codon is
+// true, each score is repeated for the 3 nucleotides of the codon.
+//
+// The support of each site is computed in the same way by comparing the
+// template with the bootstrap replicates.
+func consistentResult(inputPath string, strategies []string, template string, alns map[string]fa.Alignment, replicates []fa.Alignment, opts Options, codon bool) Result {
+	// The template matrix must come first, followed by the rest of the strategies.
+	names := []string{template}
+	matrices := [][][]int{alns[template].UngappedPositionMatrix(opts.GapChar)}
+	for _, strategy := range strategies {
+		if strategy != template {
+			names = append(names, strategy)
+			matrices = append(matrices, alns[strategy].UngappedPositionMatrix(opts.GapChar))
+		}
+	}
+	// consistentPos is a boolean slice indicating per position whether it is consistent or not.
+	// Without a quorum, this is the same as ConsistentAlignmentPositions.
+	consistencyScores := opts.scores(codon)(matrices...)
+	consistentPos := opts.MinAgreement.Positions(consistencyScores, len(matrices))
+	if opts.Metric == MetricPairs {
+		consistentPos = opts.MinAgreement.PairPositions(consistencyScores, len(matrices))
+	}
+	// Weighted alignments replace the quorum.
+	var weight []float64
+	var totalWeight float64
+	if opts.MinWeight > 0 {
+		agreement := make([][]float64, len(matrices)-1)
+		for k, matrix := range matrices[1:] {
+			agreement[k] = opts.agreement(codon)(matrices[0], matrix)
+		}
+		weight = opts.Weights.WeightedAgreement(names, len(consistentPos), agreement...)
+		totalWeight = opts.Weights.Total(names)
+		for j, w := range weight {
+			// The small tolerance absorbs rounding errors of summed weights.
+			consistentPos[j] = w >= opts.MinWeight-1e-9
+		}
+	}
+	// Sites with too many gaps in the template are inconsistent regardless of the other alignments.
+	if opts.MaxGapFraction > 0 {
+		for j, fraction := range GapFractions(matrices[0]) {
+			if fraction <= opts.MaxGapFraction {
+				continue
+			}
+			if codon {
+				consistentPos[j*3], consistentPos[j*3+1], consistentPos[j*3+2] = false, false, false
+			} else {
+				consistentPos[j] = false
+			}
+		}
+	}
+	agreement := StrategyAgreement(names, opts.agreement(codon), matrices...)
+	var residueScores [][]float64
+	if opts.ResidueScores {
+		residueScores = opts.residueScores(codon)(matrices...)
+	}
 
-	return MarkedAlignmentToBuffer(einsiAln, consistentPos, markerID, consistentMarker, inconsistentMarker)
+	var support []float64
+	var residueSupport [][]float64
+	if len(replicates) > 0 {
+		replicateMatrices := [][][]int{matrices[0]}
+		for _, aln := range replicates {
+			replicateMatrices = append(replicateMatrices, aln.UngappedPositionMatrix(opts.GapChar))
+		}
+		support = opts.scores(codon)(replicateMatrices...)
+		if opts.Metric != MetricPairs {
+			// Column scores count the template itself, which is not a replicate.
+			n := float64(len(replicateMatrices))
+			for j, score := range support {
+				support[j] = math.Max(0, (score*n-1)/(n-1))
+			}
+		}
+		residueSupport = opts.residueScores(codon)(replicateMatrices...)
+	}
+	opts.progress(".")
+
+	if opts.ToUpper == true {
+		alns[template].ToUpper()
+	} else if opts.ToLower == true {
+		alns[template].ToLower()
+	}
+
+	opts.progress(" Done.\n")
+
+	return Result{
+		InputPath:      inputPath,
+		Strategies:     strategies,
+		Alignments:     alns,
+		ConsistentPos:  consistentPos,
+		Scores:         consistencyScores,
+		MinAgreement:   opts.MinAgreement.Required(len(matrices)),
+		MinWeight:      opts.MinWeight,
+		TotalWeight:    totalWeight,
+		Weight:         weight,
+		ResidueScores:  residueScores,
+		Support:        support,
+		ResidueSupport: residueSupport,
+		Agreement:      agreement,
+		Template:       template,
+	}
 }
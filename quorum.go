@@ -0,0 +1,102 @@
+package conspos
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Quorum is the minimum number of alignments, including the template,
+// that must reproduce the alignment pattern of a site for the site to be
+// consistent. The zero Quorum requires all alignments.
+type Quorum struct {
+	// Count is the minimum number of alignments.
+	Count int
+	// Fraction is the minimum fraction of alignments, between 0 and 1.
+	// Used if Count is 0.
+	Fraction float64
+}
+
+// ParseQuorum parses a quorum given as a count such as "3", or as a
+// fraction such as "0.6" or "60%".
+func ParseQuorum(s string) (Quorum, error) {
+	if strings.HasSuffix(s, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return Quorum{}, fmt.Errorf("invalid quorum %q: percentage must be greater than 0 and at most 100", s)
+		}
+		return Quorum{Fraction: percent / 100}, nil
+	}
+	if count, err := strconv.Atoi(s); err == nil {
+		if count < 1 {
+			return Quorum{}, fmt.Errorf("invalid quorum %q: count must be at least 1", s)
+		}
+		return Quorum{Count: count}, nil
+	}
+	fraction, err := strconv.ParseFloat(s, 64)
+	if err != nil || fraction <= 0 || fraction > 1 {
+		return Quorum{}, fmt.Errorf("invalid quorum %q: expected a count, or a fraction greater than 0 and at most 1", s)
+	}
+	return Quorum{Fraction: fraction}, nil
+}
+
+// String returns the quorum as it is parsed by ParseQuorum, or "all" for
+// the zero Quorum.
+func (q Quorum) String() string {
+	switch {
+	case q.Count > 0:
+		return strconv.Itoa(q.Count)
+	case q.Fraction > 0:
+		return strconv.FormatFloat(q.Fraction, 'g', -1, 64)
+	}
+	return "all"
+}
+
+// Required returns the number of alignments out of n that must reproduce
+// the alignment pattern of a site. The result is between 1 and n.
+func (q Quorum) Required(n int) int {
+	required := n
+	switch {
+	case q.Count > 0:
+		required = q.Count
+	case q.Fraction > 0:
+		// The small tolerance keeps fractions such as 0.6 of 5 from rounding up.
+		required = int(math.Ceil(q.Fraction*float64(n) - 1e-9))
+	}
+	if required < 1 {
+		return 1
+	}
+	if required > n {
+		return n
+	}
+	return required
+}
+
+// Positions returns whether each site with the given consistency scores,
+// computed from n alignments, is reproduced by at least the quorum.
+func (q Quorum) Positions(scores []float64, n int) []bool {
+	required := q.Required(n)
+	pos := make([]bool, len(scores))
+	for j, score := range scores {
+		pos[j] = int(math.Round(score*float64(n))) >= required
+	}
+	return pos
+}
+
+// PairPositions returns whether each site with the given residue-pair
+// scores, computed from n alignments, is consistent given the quorum. A
+// site is consistent if the residue pairs of the template are reproduced
+// on average by as many of the other alignments as the quorum requires.
+func (q Quorum) PairPositions(scores []float64, n int) []bool {
+	threshold := 0.0
+	if n > 1 {
+		threshold = float64(q.Required(n)-1) / float64(n-1)
+	}
+	pos := make([]bool, len(scores))
+	for j, score := range scores {
+		// The small tolerance absorbs rounding errors of averaged scores.
+		pos[j] = score >= threshold-1e-9
+	}
+	return pos
+}
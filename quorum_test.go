@@ -0,0 +1,74 @@
+package conspos_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kentwait/conspos"
+)
+
+func TestParseQuorum(t *testing.T) {
+	tests := []struct {
+		s        string
+		want     conspos.Quorum
+		required int
+	}{
+		{"3", conspos.Quorum{Count: 3}, 3},
+		{"1", conspos.Quorum{Count: 1}, 1},
+		{"0.6", conspos.Quorum{Fraction: 0.6}, 3},
+		{"60%", conspos.Quorum{Fraction: 0.6}, 3},
+		{"0.5", conspos.Quorum{Fraction: 0.5}, 3},
+		{"1.0", conspos.Quorum{Fraction: 1}, 5},
+	}
+	for _, tt := range tests {
+		got, err := conspos.ParseQuorum(tt.s)
+		if err != nil {
+			t.Errorf("ParseQuorum(%q): %v", tt.s, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseQuorum(%q) = %+v, want %+v", tt.s, got, tt.want)
+		}
+		if required := got.Required(5); required != tt.required {
+			t.Errorf("ParseQuorum(%q).Required(5) = %d, want %d", tt.s, required, tt.required)
+		}
+	}
+
+	for _, s := range []string{"0", "-1", "0.0", "1.5", "101%", "most"} {
+		if _, err := conspos.ParseQuorum(s); err == nil {
+			t.Errorf("ParseQuorum(%q) did not return an error", s)
+		}
+	}
+}
+
+func TestRunMinAgreement(t *testing.T) {
+	opts := fakeOptions()
+	opts.MinAgreement = conspos.Quorum{Count: 2}
+	res, err := conspos.Run(context.Background(), filepath.Join("testdata", "examples", "inconsistent.fa"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.MinAgreement != 2 {
+		t.Errorf("MinAgreement = %d, want 2", res.MinAgreement)
+	}
+	// No other strategy reproduces the E-INSI template in the middle of the alignment.
+	for j, consistent := range res.ConsistentPos {
+		if consistent != (res.Scores[j] >= 2.0/3) {
+			t.Errorf("position %d: consistent = %v but score = %v", j, consistent, res.Scores[j])
+		}
+	}
+
+	opts.MinAgreement = conspos.Quorum{}
+	res, err = conspos.Run(context.Background(), filepath.Join("testdata", "examples", "inconsistent.fa"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.MinAgreement != 3 {
+		t.Errorf("MinAgreement = %d, want 3", res.MinAgreement)
+	}
+	if marker := strings.SplitN(marked(res), "\n", 3)[1]; !strings.Contains(marker, "N") {
+		t.Errorf("marker %s has no inconsistent sites without a quorum", marker)
+	}
+}
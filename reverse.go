@@ -0,0 +1,90 @@
+package conspos
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	fa "github.com/kentwait/gofasta"
+)
+
+// ReversePrefix is the prefix of strategy names that align the reversed
+// sequences. For example, "reverse-ginsi" reverses the sequences, aligns
+// them using "ginsi", and reverses the resulting alignment back. Comparing
+// the alignments of the sequences and of the reversed sequences is known
+// as the heads-or-tails test.
+const ReversePrefix = "reverse-"
+
+// reversingAligner runs the strategies of an Aligner on reversed sequences
+// when the strategy name starts with ReversePrefix.
+type reversingAligner struct {
+	Aligner
+}
+
+// Align aligns the sequences read from r using the strategy. If the
+// strategy starts with ReversePrefix, the sequences are reversed before
+// alignment and the alignment is reversed back.
+func (a reversingAligner) Align(ctx context.Context, r io.Reader, strategy string, threads int) (fa.Alignment, error) {
+	if !strings.HasPrefix(strategy, ReversePrefix) {
+		return a.Aligner.Align(ctx, r, strategy, threads)
+	}
+	input, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	reversed := reverseAlignment(fa.FastaToAlignment(bytes.NewReader(input), false))
+	aln, err := a.Aligner.Align(ctx, strings.NewReader(reversed.String()), strings.TrimPrefix(strategy, ReversePrefix), threads)
+	if err != nil {
+		return nil, err
+	}
+	forward := reverseAlignment(aln)
+	return fa.FastaToAlignment(&forward, false), nil
+}
+
+// reverseAlignment writes the sequences of aln in reverse order of
+// residues in the FASTA format to a buffer.
+func reverseAlignment(aln fa.Alignment) bytes.Buffer {
+	var buffer bytes.Buffer
+	for _, s := range aln {
+		if len(s.Description()) > 0 {
+			buffer.WriteString(fmt.Sprintf(">%s %s\n", s.ID(), s.Description()))
+		} else {
+			buffer.WriteString(fmt.Sprintf(">%s\n", s.ID()))
+		}
+		seq := []byte(s.Sequence())
+		for i, j := 0, len(seq)-1; i < j; i, j = i+1, j-1 {
+			seq[i], seq[j] = seq[j], seq[i]
+		}
+		buffer.Write(seq)
+		buffer.WriteString("\n")
+	}
+	return buffer
+}
+
+// WithReversed returns the strategies run by the heads-or-tails test: the
+// strategies and the reversed strategy of each strategy that is neither
+// reversed nor listed reversed already. The reversed strategies are
+// inserted before the last strategy so that the template is unchanged.
+func WithReversed(strategies []string) []string {
+	listed := make(map[string]bool)
+	for _, strategy := range strategies {
+		listed[strategy] = true
+	}
+	var reversed []string
+	for _, strategy := range strategies {
+		if !strings.HasPrefix(strategy, ReversePrefix) && !listed[ReversePrefix+strategy] {
+			reversed = append(reversed, ReversePrefix+strategy)
+		}
+	}
+	if len(strategies) == 0 {
+		return reversed
+	}
+	last := len(strategies) - 1
+	var all []string
+	all = append(all, strategies[:last]...)
+	all = append(all, reversed...)
+	return append(all, strategies[last])
+}
@@ -0,0 +1,68 @@
+package conspos_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kentwait/conspos"
+	fa "github.com/kentwait/gofasta"
+)
+
+func TestRunHeadsOrTails(t *testing.T) {
+	inputPath := filepath.Join("testdata", "examples", "inconsistent.fa")
+	opts := conspos.DefaultOptions()
+	opts.Aligner = conspos.NewNative()
+	opts.Strategies = []string{"local", "global"}
+	opts.HeadsOrTails = true
+	res, err := conspos.Run(context.Background(), inputPath, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantStrategies := []string{"local", "reverse-local", "reverse-global", "global"}
+	if !reflect.DeepEqual(res.Strategies, wantStrategies) {
+		t.Errorf("Strategies = %v, want %v", res.Strategies, wantStrategies)
+	}
+	if res.Template != "global" {
+		t.Errorf("Template = %q, want global", res.Template)
+	}
+
+	// The alignments of the reversed sequences are reversed back to the input orientation.
+	input, err := ioutil.ReadFile(inputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seqs := fa.FastaToAlignment(bytes.NewReader(input), false)
+	for _, strategy := range []string{"reverse-local", "reverse-global"} {
+		aln := res.Alignments[strategy]
+		if len(aln) != len(seqs) {
+			t.Fatalf("%s: %d sequences, want %d", strategy, len(aln), len(seqs))
+		}
+		for i, s := range aln {
+			ungapped := strings.Replace(s.Sequence(), "-", "", -1)
+			if s.ID() != seqs[i].ID() || !strings.EqualFold(ungapped, seqs[i].Sequence()) {
+				t.Errorf("%s: sequence %d is %s %s, want %s %s", strategy, i, s.ID(), ungapped, seqs[i].ID(), seqs[i].Sequence())
+			}
+		}
+	}
+}
+
+func TestWithReversed(t *testing.T) {
+	tests := []struct {
+		strategies, want []string
+	}{
+		{[]string{"einsi", "linsi"}, []string{"einsi", "reverse-einsi", "reverse-linsi", "linsi"}},
+		// Strategies that are already listed reversed are not added again.
+		{[]string{"einsi", "reverse-einsi", "linsi"}, []string{"einsi", "reverse-einsi", "reverse-linsi", "linsi"}},
+	}
+	for _, tt := range tests {
+		if got := conspos.WithReversed(tt.strategies); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("WithReversed(%v) = %v, want %v", tt.strategies, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package conspos
+
+import "strings"
+
+// substitution holds the alphabet and the residue substitution scores
+// used by the native aligner.
+type substitution struct {
+	// index maps a residue character to its index in scores.
+	// Residues not in the alphabet are mapped to unknown.
+	index   [256]int
+	unknown int
+	scores  [][]float64
+}
+
+// score returns the substitution score between residue indices x and y.
+func (s *substitution) score(x, y int) float64 {
+	return s.scores[x][y]
+}
+
+// encode converts a sequence into residue indices.
+func (s *substitution) encode(seq string) []int {
+	encoded := make([]int, len(seq))
+	for i := 0; i < len(seq); i++ {
+		encoded[i] = s.index[seq[i]]
+	}
+	return encoded
+}
+
+// newSubstitution creates a substitution from an alphabet and its score
+// matrix. unknown is the residue that characters outside the alphabet are
+// mapped to.
+func newSubstitution(alphabet string, scores [][]float64, unknown byte) *substitution {
+	s := &substitution{scores: scores, unknown: strings.IndexByte(alphabet, unknown)}
+	for i := range s.index {
+		s.index[i] = s.unknown
+	}
+	for i := 0; i < len(alphabet); i++ {
+		c := alphabet[i]
+		s.index[c] = i
+		if c >= 'A' && c <= 'Z' {
+			s.index[c+'a'-'A'] = i
+		}
+	}
+	return s
+}
+
+// nucleotideSubstitution scores matches as 5 and mismatches as -4.
+// Ambiguous bases are scored as -1 against any base.
+func nucleotideSubstitution() *substitution {
+	const alphabet = "ACGTN"
+	scores := make([][]float64, len(alphabet))
+	for i := range scores {
+		scores[i] = make([]float64, len(alphabet))
+		for j := range scores[i] {
+			switch {
+			case alphabet[i] == 'N' || alphabet[j] == 'N':
+				scores[i][j] = -1
+			case i == j:
+				scores[i][j] = 5
+			default:
+				scores[i][j] = -4
+			}
+		}
+	}
+	s := newSubstitution(alphabet, scores, 'N')
+	// Uracil is scored as thymine
+	s.index['U'], s.index['u'] = s.index['T'], s.index['T']
+	return s
+}
+
+// blosum62Alphabet is the residue order of blosum62.
+const blosum62Alphabet = "ARNDCQEGHILKMFPSTWYVBZX*"
+
+// blosum62 is the BLOSUM62 amino acid substitution matrix.
+var blosum62 = [][]float64{
+	{4, -1, -2, -2, 0, -1, -1, 0, -2, -1, -1, -1, -1, -2, -1, 1, 0, -3, -2, 0, -2, -1, 0, -4},
+	{-1, 5, 0, -2, -3, 1, 0, -2, 0, -3, -2, 2, -1, -3, -2, -1, -1, -3, -2, -3, -1, 0, -1, -4},
+	{-2, 0, 6, 1, -3, 0, 0, 0, 1, -3, -3, 0, -2, -3, -2, 1, 0, -4, -2, -3, 3, 0, -1, -4},
+	{-2, -2, 1, 6, -3, 0, 2, -1, -1, -3, -4, -1, -3, -3, -1, 0, -1, -4, -3, -3, 4, 1, -1, -4},
+	{0, -3, -3, -3, 9, -3, -4, -3, -3, -1, -1, -3, -1, -2, -3, -1, -1, -2, -2, -1, -3, -3, -2, -4},
+	{-1, 1, 0, 0, -3, 5, 2, -2, 0, -3, -2, 1, 0, -3, -1, 0, -1, -2, -1, -2, 0, 3, -1, -4},
+	{-1, 0, 0, 2, -4, 2, 5, -2, 0, -3, -3, 1, -2, -3, -1, 0, -1, -3, -2, -2, 1, 4, -1, -4},
+	{0, -2, 0, -1, -3, -2, -2, 6, -2, -4, -4, -2, -3, -3, -2, 0, -2, -2, -3, -3, -1, -2, -1, -4},
+	{-2, 0, 1, -1, -3, 0, 0, -2, 8, -3, -3, -1, -2, -1, -2, -1, -2, -2, 2, -3, 0, 0, -1, -4},
+	{-1, -3, -3, -3, -1, -3, -3, -4, -3, 4, 2, -3, 1, 0, -3, -2, -1, -3, -1, 3, -3, -3, -1, -4},
+	{-1, -2, -3, -4, -1, -2, -3, -4, -3, 2, 4, -2, 2, 0, -3, -2, -1, -2, -1, 1, -4, -3, -1, -4},
+	{-1, 2, 0, -1, -3, 1, 1, -2, -1, -3, -2, 5, -1, -3, -1, 0, -1, -3, -2, -2, 0, 1, -1, -4},
+	{-1, -1, -2, -3, -1, 0, -2, -3, -2, 1, 2, -1, 5, 0, -2, -1, -1, -1, -1, 1, -3, -1, -1, -4},
+	{-2, -3, -3, -3, -2, -3, -3, -3, -1, 0, 0, -3, 0, 6, -4, -2, -2, 1, 3, -1, -3, -3, -1, -4},
+	{-1, -2, -2, -1, -3, -1, -1, -2, -2, -3, -3, -1, -2, -4, 7, -1, -1, -4, -3, -2, -2, -1, -2, -4},
+	{1, -1, 1, 0, -1, 0, 0, 0, -1, -2, -2, 0, -1, -2, -1, 4, 1, -3, -2, -2, 0, 0, 0, -4},
+	{0, -1, 0, -1, -1, -1, -1, -2, -2, -1, -1, -1, -1, -2, -1, 1, 5, -2, -2, 0, -1, -1, 0, -4},
+	{-3, -3, -4, -4, -2, -2, -3, -2, -2, -3, -2, -3, -1, 1, -4, -3, -2, 11, 2, -3, -4, -3, -2, -4},
+	{-2, -2, -2, -3, -2, -1, -2, -3, 2, -1, -1, -2, -1, 3, -3, -2, -2, 2, 7, -1, -3, -2, -1, -4},
+	{0, -3, -3, -3, -1, -2, -2, -3, -3, 3, 1, -2, 1, -1, -2, -2, 0, -3, -1, 4, -3, -2, -1, -4},
+	{-2, -1, 3, 4, -3, 0, 1, -1, 0, -3, -4, 0, -3, -3, -2, 0, -1, -4, -3, -3, 4, 1, -1, -4},
+	{-1, 0, 0, 1, -3, 3, 4, -2, 0, -3, -3, 1, -1, -3, -1, 0, -1, -3, -2, -2, 1, 4, -1, -4},
+	{0, -1, -1, -1, -2, -1, -1, -1, -1, -1, -1, -1, -1, -1, -2, 0, 0, -2, -1, -1, -1, -1, -1, -4},
+	{-4, -4, -4, -4, -4, -4, -4, -4, -4, -4, -4, -4, -4, -4, -4, -4, -4, -4, -4, -4, -4, -4, -4, 1},
+}
+
+// proteinSubstitution scores residues using BLOSUM62.
+func proteinSubstitution() *substitution {
+	return newSubstitution(blosum62Alphabet, blosum62, 'X')
+}
+
+// guessSubstitution returns the nucleotide substitution scores if most of
+// the residues in seqs are nucleotides, and BLOSUM62 otherwise.
+func guessSubstitution(seqs []string) *substitution {
+	var nucleotides, total int
+	for _, seq := range seqs {
+		for _, c := range strings.ToUpper(seq) {
+			switch c {
+			case 'A', 'C', 'G', 'T', 'U', 'N':
+				nucleotides++
+			}
+			total++
+		}
+	}
+	if total > 0 && float64(nucleotides)/float64(total) >= 0.9 {
+		return nucleotideSubstitution()
+	}
+	return proteinSubstitution()
+}
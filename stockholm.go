@@ -0,0 +1,62 @@
+package conspos
+
+import (
+	"bytes"
+	"fmt"
+
+	fa "github.com/kentwait/gofasta"
+)
+
+// StockholmMarkerTag is the tag of the #=GC line that holds the marker in
+// the Stockholm format.
+const StockholmMarkerTag = "conspos"
+
+// Feature is an annotation of a whole alignment, such as the strategies
+// that were compared.
+type Feature struct {
+	Tag  string
+	Text string
+}
+
+// StockholmToBuffer writes the template alignment in the Stockholm format
+// to the buffer. The features are written as #=GF lines before the
+// sequences. The marker is written as the #=GC line tagged
+// StockholmMarkerTag, followed by a #=GC line for each track tagged by its
+// ID, where each site is its score as a digit given by ScoreDigits.
+// Returns an error if sequence IDs are not unique.
+func StockholmToBuffer(template fa.Alignment, consistentPos []bool, consistentMarker, inconsistentMarker string, features []Feature, tracks ...Track) (bytes.Buffer, error) {
+	var buffer bytes.Buffer
+	if err := checkUniqueIDs(template); err != nil {
+		return buffer, err
+	}
+	// Sequences and annotations are padded to the same width so that sites line up.
+	width := len("#=GC " + StockholmMarkerTag)
+	for _, s := range template {
+		if len(s.ID()) > width {
+			width = len(s.ID())
+		}
+	}
+	for _, track := range tracks {
+		if len("#=GC "+track.ID) > width {
+			width = len("#=GC " + track.ID)
+		}
+	}
+
+	buffer.WriteString("# STOCKHOLM 1.0\n")
+	for _, feature := range features {
+		buffer.WriteString(fmt.Sprintf("#=GF %s %s\n", feature.Tag, feature.Text))
+	}
+	if len(features) > 0 {
+		buffer.WriteString("\n")
+	}
+	for _, s := range template {
+		buffer.WriteString(fmt.Sprintf("%-*s %s\n", width, s.ID(), s.Sequence()))
+	}
+
+	buffer.WriteString(fmt.Sprintf("%-*s %s\n", width, "#=GC "+StockholmMarkerTag, markerString(consistentPos, consistentMarker, inconsistentMarker)))
+	for _, track := range tracks {
+		buffer.WriteString(fmt.Sprintf("%-*s %s\n", width, "#=GC "+track.ID, ScoreDigits(track.Scores)))
+	}
+	buffer.WriteString("//\n")
+	return buffer, nil
+}
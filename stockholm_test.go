@@ -0,0 +1,35 @@
+package conspos_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kentwait/conspos"
+	fa "github.com/kentwait/gofasta"
+)
+
+func TestStockholmToBuffer(t *testing.T) {
+	aln := fa.FastaToAlignment(strings.NewReader(">a\nACGT-\n>b\nAC-TT\n"), false)
+	features := []conspos.Feature{{Tag: "strategies", Text: "ginsi,linsi,einsi"}}
+	track := conspos.Track{ID: "score", Scores: []float64{1, 1, 1.0 / 3, 1, 2.0 / 3}}
+	buffer, err := conspos.StockholmToBuffer(aln, []bool{true, true, false, true, false}, "C", "N", features, track)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# STOCKHOLM 1.0\n" +
+		"#=GF strategies ginsi,linsi,einsi\n" +
+		"\n" +
+		"a            ACGT-\n" +
+		"b            AC-TT\n" +
+		"#=GC conspos CCNCN\n" +
+		"#=GC score   99396\n" +
+		"//\n"
+	if got := buffer.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	duplicated := fa.FastaToAlignment(strings.NewReader(">a\nAC\n>a\nAC\n"), false)
+	if _, err := conspos.StockholmToBuffer(duplicated, []bool{true, true}, "C", "N", nil); err == nil {
+		t.Error("Stockholm of duplicated IDs did not return an error")
+	}
+}
@@ -0,0 +1,67 @@
+package conspos
+
+import (
+	"fmt"
+	"strings"
+
+	fa "github.com/kentwait/gofasta"
+)
+
+// TemplateBest selects as the template the alignment that agrees the most
+// with the alignments of the other strategies.
+const TemplateBest = "best"
+
+// checkTemplate returns an error if the template set in the options is
+// not one of the strategies.
+func (o Options) checkTemplate(strategies []string) error {
+	if len(o.Template) == 0 || o.Template == TemplateBest {
+		return nil
+	}
+	for _, strategy := range strategies {
+		if strategy == o.Template {
+			return nil
+		}
+	}
+	return fmt.Errorf("template %s is not one of the strategies %s", o.Template, strings.Join(strategies, ","))
+}
+
+// template returns the strategy whose alignment is the template. The last
+// strategy is the template unless another is set in the options.
+func (o Options) template(strategies []string, alns map[string]fa.Alignment, codon bool) string {
+	switch o.Template {
+	case "":
+		return strategies[len(strategies)-1]
+	case TemplateBest:
+		return o.bestTemplate(strategies, alns, codon)
+	}
+	return o.Template
+}
+
+// bestTemplate returns the strategy whose alignment agrees the most with
+// the alignments of the other strategies given the metric, averaged over
+// its sites. Ties are won by the strategy run last.
+func (o Options) bestTemplate(strategies []string, alns map[string]fa.Alignment, codon bool) string {
+	matrices := make([][][]int, len(strategies))
+	for k, strategy := range strategies {
+		matrices[k] = alns[strategy].UngappedPositionMatrix(o.GapChar)
+	}
+
+	best, bestAgreement := len(strategies)-1, -1.0
+	for k := len(strategies) - 1; k >= 0; k-- {
+		var total float64
+		for l := range strategies {
+			if l == k {
+				continue
+			}
+			agreement := o.agreement(codon)(matrices[k], matrices[l])
+			for _, a := range agreement {
+				total += a / float64(len(agreement))
+			}
+		}
+		// The small tolerance keeps rounding errors from breaking ties.
+		if total > bestAgreement+1e-9 {
+			best, bestAgreement = k, total
+		}
+	}
+	return strategies[best]
+}
@@ -0,0 +1,45 @@
+package conspos_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/kentwait/conspos"
+)
+
+func TestRunTemplate(t *testing.T) {
+	input := filepath.Join("testdata", "examples", "inconsistent.fa")
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"", "einsi"},
+		{"ginsi", "ginsi"},
+		// G-INSI and L-INSI agree with each other but not with E-INSI, and L-INSI runs last.
+		{conspos.TemplateBest, "linsi"},
+	}
+	for _, tt := range tests {
+		opts := fakeOptions()
+		opts.Template = tt.template
+		res, err := conspos.Run(context.Background(), input, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Template != tt.want {
+			t.Errorf("Template %q: template = %s, want %s", tt.template, res.Template, tt.want)
+		}
+		if got := res.TemplateAlignment().ToFasta(); got != res.Alignments[tt.want].ToFasta() {
+			t.Errorf("Template %q: template alignment is not the %s alignment", tt.template, tt.want)
+		}
+		if len(res.ConsistentPos) != len(res.Alignments[tt.want][0].Sequence()) {
+			t.Errorf("Template %q: %d sites, want the length of the %s alignment", tt.template, len(res.ConsistentPos), tt.want)
+		}
+	}
+
+	opts := fakeOptions()
+	opts.Template = "fftns2"
+	if _, err := conspos.Run(context.Background(), input, opts); err == nil {
+		t.Error("Run did not return an error for a template that is not one of the strategies")
+	}
+}
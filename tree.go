@@ -0,0 +1,135 @@
+package conspos
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+
+	fa "github.com/kentwait/gofasta"
+)
+
+// Bootstrap sets the replicate alignments of a GUIDANCE-style bootstrap,
+// where each replicate is aligned following a guide tree built from sites
+// of the template alignment sampled with replacement. The support of a
+// site is the fraction of replicates that reproduce it, which does not
+// depend on the choice of strategies.
+type Bootstrap struct {
+	// Replicates is the number of replicate alignments. No replicates are
+	// aligned if zero.
+	Replicates int
+	// Strategy is the strategy used to align the replicates. If empty, the
+	// strategy of the template is used.
+	Strategy string
+	// Seed initializes the sampling of sites.
+	Seed int64
+}
+
+// GuideTree is a rooted binary guide tree given by the order in which
+// clusters of sequences are merged.
+type GuideTree struct {
+	// Merges lists the pairs of clusters that are merged, in order. Each
+	// cluster is identified by the smallest index of its sequences, such
+	// that the merged cluster takes the index of the first cluster.
+	Merges [][2]int
+	// Lengths lists the lengths of the branches from each merge to the two
+	// clusters that are merged.
+	Lengths [][2]float64
+}
+
+// check returns an error if the tree does not join n sequences.
+func (t GuideTree) check(n int) error {
+	if len(t.Merges) != n-1 {
+		return fmt.Errorf("guide tree has %d merges but %d sequences were given", len(t.Merges), n)
+	}
+	merged := make([]bool, n)
+	for _, pair := range t.Merges {
+		a, b := pair[0], pair[1]
+		if a < 0 || b >= n || a >= b || merged[a] || merged[b] {
+			return fmt.Errorf("guide tree merges invalid clusters %d and %d", a, b)
+		}
+		merged[b] = true
+	}
+	return nil
+}
+
+// MafftFormat returns the guide tree in the format read by the --treein
+// option of MAFFT, where clusters are numbered from 1.
+func (t GuideTree) MafftFormat() string {
+	var buffer bytes.Buffer
+	for k, pair := range t.Merges {
+		var lengths [2]float64
+		if k < len(t.Lengths) {
+			lengths = t.Lengths[k]
+		}
+		buffer.WriteString(fmt.Sprintf("%5d %5d %10.5f %10.5f\n", pair[0]+1, pair[1]+1, lengths[0], lengths[1]))
+	}
+	return buffer.String()
+}
+
+// BootstrapTree builds a UPGMA guide tree from the distances between the
+// aligned sequences of aln over sites sampled with replacement. The
+// distance between two sequences is the proportion of differences over
+// the sampled sites where neither has a gap.
+func BootstrapTree(aln fa.Alignment, rng *rand.Rand) GuideTree {
+	rows := make([]string, len(aln))
+	for i, s := range aln {
+		rows[i] = s.Sequence()
+	}
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return GuideTree{}
+	}
+	sites := make([]int, len(rows[0]))
+	for k := range sites {
+		sites[k] = rng.Intn(len(sites))
+	}
+
+	dist := make([][]float64, len(rows))
+	for i := range dist {
+		dist[i] = make([]float64, len(rows))
+	}
+	for a := range rows {
+		for b := a + 1; b < len(rows); b++ {
+			var compared, differences int
+			for _, j := range sites {
+				x, y := rows[a][j], rows[b][j]
+				if x == '-' || y == '-' {
+					continue
+				}
+				compared++
+				if x|0x20 != y|0x20 {
+					differences++
+				}
+			}
+			// Sequences that cannot be compared are as distant as possible
+			d := 1.0
+			if compared > 0 {
+				d = float64(differences) / float64(compared)
+			}
+			dist[a][b], dist[b][a] = d, d
+		}
+	}
+	return guideTree(dist)
+}
+
+// TreeAligner is an Aligner that can align sequences following a given
+// guide tree.
+type TreeAligner interface {
+	Aligner
+	// AlignWithTree aligns the sequences read from r using the strategy
+	// and the guide tree, whose indices are the order of the sequences.
+	AlignWithTree(ctx context.Context, r io.Reader, strategy string, tree GuideTree, threads int) (fa.Alignment, error)
+}
+
+// fixedTreeAligner aligns sequences using a TreeAligner and a fixed guide
+// tree, such that it can be used wherever an Aligner is expected.
+type fixedTreeAligner struct {
+	TreeAligner
+	tree GuideTree
+}
+
+// Align aligns the sequences read from r following the fixed guide tree.
+func (a fixedTreeAligner) Align(ctx context.Context, r io.Reader, strategy string, threads int) (fa.Alignment, error) {
+	return a.AlignWithTree(ctx, r, strategy, a.tree, threads)
+}
@@ -0,0 +1,80 @@
+package conspos_test
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kentwait/conspos"
+	"github.com/kentwait/conspos/internal/fakealigner"
+	fa "github.com/kentwait/gofasta"
+)
+
+func TestBootstrapTreeMafftFormat(t *testing.T) {
+	// Every site separates the first two sequences from the last two.
+	aln := fa.FastaToAlignment(strings.NewReader(">a\nAAAA\n>b\nAAAA\n>c\nCCCC\n>d\nCCCC\n"), false)
+	tree := conspos.BootstrapTree(aln, rand.New(rand.NewSource(1)))
+	want := "" +
+		"    1     2    0.00000    0.00000\n" +
+		"    3     4    0.00000    0.00000\n" +
+		"    1     3    0.50000    0.50000\n"
+	if got := tree.MafftFormat(); got != want {
+		t.Errorf("MafftFormat =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRunBootstrapNative(t *testing.T) {
+	opts := conspos.DefaultOptions()
+	opts.Aligner = conspos.NewNative()
+	opts.Strategies = []string{"local", "global"}
+	opts.Bootstrap = conspos.Bootstrap{Replicates: 3, Seed: 1}
+	res, err := conspos.Run(context.Background(), filepath.Join("testdata", "examples", "inconsistent.fa"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Support) != len(res.ConsistentPos) {
+		t.Fatalf("%d support values for %d sites", len(res.Support), len(res.ConsistentPos))
+	}
+	for j, support := range res.Support {
+		if support < 0 || support > 1 {
+			t.Errorf("site %d: support = %v, want between 0 and 1", j+1, support)
+		}
+	}
+	if len(res.ResidueSupport) != len(res.TemplateAlignment()) {
+		t.Errorf("residue support of %d sequences, want %d", len(res.ResidueSupport), len(res.TemplateAlignment()))
+	}
+}
+
+func TestRunBootstrapFakeMafft(t *testing.T) {
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(fakealigner.DirEnv, filepath.Join("testdata", "alignments"))
+
+	opts := conspos.DefaultOptions()
+	opts.MafftPath = executable
+	opts.Bootstrap = conspos.Bootstrap{Replicates: 2}
+	res, err := conspos.Run(context.Background(), filepath.Join("testdata", "examples", "inconsistent.fa"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The fake MAFFT returns the E-INSI template for every guide tree.
+	for j, support := range res.Support {
+		if support != 1 {
+			t.Fatalf("site %d: support = %v, want 1", j+1, support)
+		}
+	}
+}
+
+func TestRunBootstrapUnsupportedAligner(t *testing.T) {
+	opts := fakeOptions()
+	opts.Bootstrap = conspos.Bootstrap{Replicates: 2}
+	_, err := conspos.Run(context.Background(), filepath.Join("testdata", "examples", "consistent.fa"), opts)
+	if err == nil {
+		t.Fatal("Run did not return an error for an aligner that cannot follow a guide tree")
+	}
+}
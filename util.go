@@ -1,30 +1,137 @@
-package main
+package conspos
 
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"reflect"
 
 	fa "github.com/kentwait/gofasta"
 )
 
+// blockWidth is the number of sites per line of the output formats that
+// write alignments in blocks.
+const blockWidth = 60
+
 // MarkedAlignmentToBuffer writes a marked multiple sequence alignment
 // in the FASTA format to the buffer.
 func MarkedAlignmentToBuffer(template fa.Alignment, consistentPos []bool, markerID, consistentMarker, inconsistentMarker string) bytes.Buffer {
 	var buffer bytes.Buffer
+	writeMarker(&buffer, consistentPos, markerID, consistentMarker, inconsistentMarker)
+	writeAlignment(&buffer, template)
+	return buffer
+}
+
+// Track is a sequence of scores per site of an alignment, such as the
+// consistency scores or the bootstrap support.
+type Track struct {
+	ID     string
+	Scores []float64
+}
+
+// TrackedAlignmentToBuffer writes a marked multiple sequence alignment
+// in the FASTA format to the buffer, with a sequence for each track after
+// the marker sequence. Each site of a track is its score as a digit given
+// by ScoreDigits.
+func TrackedAlignmentToBuffer(template fa.Alignment, consistentPos []bool, markerID, consistentMarker, inconsistentMarker string, tracks ...Track) bytes.Buffer {
+	var buffer bytes.Buffer
+	writeMarker(&buffer, consistentPos, markerID, consistentMarker, inconsistentMarker)
+	for _, track := range tracks {
+		buffer.WriteString(fmt.Sprintf(">%s\n%s\n", track.ID, ScoreDigits(track.Scores)))
+	}
+	writeAlignment(&buffer, template)
+	return buffer
+}
+
+// ScoreDigits converts scores between 0 and 1 into a string of digits
+// from 0 to 9, where 9 is a score of 1. Negative scores, such as the
+// scores of gaps, are written as "-".
+func ScoreDigits(scores []float64) string {
+	digits := make([]byte, len(scores))
+	for i, score := range scores {
+		if score < 0 {
+			digits[i] = '-'
+			continue
+		}
+		digits[i] = '0' + byte(math.Round(score*9))
+	}
+	return string(digits)
+}
+
+// ResidueScoresToBuffer writes the residue scores of the template
+// alignment in the FASTA format to the buffer. Each sequence has the same
+// header as in the template, and each residue is replaced by its score as
+// a digit given by ScoreDigits.
+func ResidueScoresToBuffer(template fa.Alignment, scores [][]float64) bytes.Buffer {
+	var buffer bytes.Buffer
+	for i, s := range template {
+		if len(s.Description()) > 0 {
+			buffer.WriteString(fmt.Sprintf(">%s %s\n", s.ID(), s.Description()))
+		} else {
+			buffer.WriteString(fmt.Sprintf(">%s\n", s.ID()))
+		}
+		buffer.WriteString(ScoreDigits(scores[i]) + "\n")
+	}
+	return buffer
+}
+
+// ResidueScoresToTSVBuffer writes the residue scores of the template
+// alignment as tab-separated values to the buffer. Each row is a residue
+// given by the sequence ID, its site in the alignment and its position in
+// the sequence, both starting from 1, followed by the residue and its
+// score. Gaps are not written.
+func ResidueScoresToTSVBuffer(template fa.Alignment, scores [][]float64) bytes.Buffer {
+	var buffer bytes.Buffer
+	buffer.WriteString("id\tsite\tposition\tresidue\tscore\n")
+	for i, s := range template {
+		seq := s.Sequence()
+		position := 0
+		for j, score := range scores[i] {
+			if score < 0 {
+				continue
+			}
+			position++
+			buffer.WriteString(fmt.Sprintf("%s\t%d\t%d\t%c\t%.4f\n", s.ID(), j+1, position, seq[j], score))
+		}
+	}
+	return buffer
+}
 
-	// Append marker sequence
+// writeMarker writes the marker sequence to the buffer.
+func writeMarker(buffer *bytes.Buffer, consistentPos []bool, markerID, consistentMarker, inconsistentMarker string) {
 	buffer.WriteString(fmt.Sprintf(">%s\n", markerID))
+	buffer.WriteString(markerString(consistentPos, consistentMarker, inconsistentMarker) + "\n")
+}
+
+// markerString returns the marker, which has the consistent marker at
+// consistent sites and the inconsistent marker elsewhere.
+func markerString(consistentPos []bool, consistentMarker, inconsistentMarker string) string {
+	var marker bytes.Buffer
 	for _, t := range consistentPos {
 		if t == true {
-			buffer.WriteString(consistentMarker)
+			marker.WriteString(consistentMarker)
 		} else {
-			buffer.WriteString(inconsistentMarker)
+			marker.WriteString(inconsistentMarker)
+		}
+	}
+	return marker.String()
+}
+
+// checkUniqueIDs returns an error if sequence IDs of the alignment are not
+// unique, which formats that identify sequences by ID cannot write.
+func checkUniqueIDs(template fa.Alignment) error {
+	seen := make(map[string]bool)
+	for _, s := range template {
+		if seen[s.ID()] {
+			return fmt.Errorf("sequence ID %s is used more than once", s.ID())
 		}
+		seen[s.ID()] = true
 	}
-	buffer.WriteString("\n")
+	return nil
+}
 
-	// Append each Sequence in Alignment
+// writeAlignment writes each Sequence in Alignment to the buffer.
+func writeAlignment(buffer *bytes.Buffer, template fa.Alignment) {
 	for _, s := range template {
 		if len(s.Description()) > 0 {
 			buffer.WriteString(fmt.Sprintf(">%s %s\n", s.ID(), s.Description()))
@@ -33,7 +140,6 @@ func MarkedAlignmentToBuffer(template fa.Alignment, consistentPos []bool, marker
 		}
 		buffer.WriteString(s.Sequence() + "\n")
 	}
-	return buffer
 }
 
 // AlignCodonsUsingProtAlignment takes an unaligned set of codon sequences and an
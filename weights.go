@@ -0,0 +1,103 @@
+package conspos
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Weights maps strategies to the weight of their alignments when deciding
+// whether a site is consistent. Strategies that are not listed weigh 1,
+// and reversed strategies weigh the same as the strategy they reverse
+// unless they are listed themselves.
+type Weights map[string]float64
+
+// ParseWeights parses weights given as comma-separated strategy=weight
+// pairs, such as "einsi=2,ginsi=0.5". Weights must be positive.
+func ParseWeights(s string) (Weights, error) {
+	w := make(Weights)
+	for _, pair := range strings.Split(s, ",") {
+		nameWeight := strings.SplitN(pair, "=", 2)
+		if len(nameWeight) != 2 || len(nameWeight[0]) == 0 {
+			return nil, fmt.Errorf("invalid weight %q: expected strategy=weight", pair)
+		}
+		weight, err := strconv.ParseFloat(nameWeight[1], 64)
+		if err != nil || weight <= 0 {
+			return nil, fmt.Errorf("invalid weight %q: weight must be a positive number", pair)
+		}
+		if _, ok := w[nameWeight[0]]; ok {
+			return nil, fmt.Errorf("strategy %q is weighted more than once", nameWeight[0])
+		}
+		w[nameWeight[0]] = weight
+	}
+	return w, nil
+}
+
+// String returns the weights as they are parsed by ParseWeights, sorted
+// by strategy.
+func (w Weights) String() string {
+	var pairs []string
+	for name, weight := range w {
+		pairs = append(pairs, name+"="+strconv.FormatFloat(weight, 'g', -1, 64))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Check returns an error if a weighted strategy is not one of the
+// strategies, such as a misspelled strategy, whose weight would otherwise
+// be ignored. Reversed strategies must be listed to be weighted.
+func (w Weights) Check(strategies []string) error {
+	listed := make(map[string]bool)
+	for _, strategy := range strategies {
+		listed[strategy] = true
+	}
+	var unknown []string
+	for name := range w {
+		if !listed[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("%s weighted but not one of the strategies %s", strings.Join(unknown, ","), strings.Join(strategies, ","))
+	}
+	return nil
+}
+
+// Weight returns the weight of the strategy.
+func (w Weights) Weight(strategy string) float64 {
+	if weight, ok := w[strategy]; ok {
+		return weight
+	}
+	if weight, ok := w[strings.TrimPrefix(strategy, ReversePrefix)]; ok {
+		return weight
+	}
+	return 1
+}
+
+// Total returns the summed weight of the strategies.
+func (w Weights) Total(strategies []string) float64 {
+	var total float64
+	for _, strategy := range strategies {
+		total += w.Weight(strategy)
+	}
+	return total
+}
+
+// WeightedAgreement returns the summed weight of the alignments that agree
+// with the template at each of the sites, where agreement[k] is the
+// agreement per site between 0 and 1 of the alignment of the strategy
+// names[k+1] with the template, the strategy names[0]. The template always
+// agrees with itself.
+func (w Weights) WeightedAgreement(names []string, sites int, agreement ...[]float64) []float64 {
+	weighted := make([]float64, sites)
+	for j := range weighted {
+		weighted[j] = w.Weight(names[0])
+		for k, a := range agreement {
+			weighted[j] += w.Weight(names[k+1]) * a[j]
+		}
+	}
+	return weighted
+}
@@ -0,0 +1,101 @@
+package conspos_test
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kentwait/conspos"
+)
+
+func TestParseWeights(t *testing.T) {
+	w, err := conspos.ParseWeights("einsi=2,ginsi=0.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (conspos.Weights{"einsi": 2, "ginsi": 0.5}); !reflect.DeepEqual(w, want) {
+		t.Errorf("ParseWeights = %v, want %v", w, want)
+	}
+	if got := w.String(); got != "einsi=2,ginsi=0.5" {
+		t.Errorf("String = %q", got)
+	}
+	tests := []struct {
+		strategy string
+		want     float64
+	}{
+		{"einsi", 2},
+		{"reverse-einsi", 2},
+		{"linsi", 1},
+	}
+	for _, tt := range tests {
+		if got := w.Weight(tt.strategy); got != tt.want {
+			t.Errorf("Weight(%q) = %v, want %v", tt.strategy, got, tt.want)
+		}
+	}
+
+	for _, s := range []string{"", "einsi", "=2", "einsi=0", "einsi=-1", "einsi=heavy", "einsi=1,einsi=2"} {
+		if _, err := conspos.ParseWeights(s); err == nil {
+			t.Errorf("ParseWeights(%q) did not return an error", s)
+		}
+	}
+}
+
+func TestRunMinWeight(t *testing.T) {
+	input := filepath.Join("testdata", "examples", "inconsistent.fa")
+	unweighted, err := conspos.Run(context.Background(), input, fakeOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The E-INSI template outweighs the other strategies together.
+	opts := fakeOptions()
+	opts.Weights = conspos.Weights{"einsi": 2}
+	opts.MinWeight = 2
+	res, err := conspos.Run(context.Background(), input, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TotalWeight != 4 {
+		t.Errorf("TotalWeight = %v, want 4", res.TotalWeight)
+	}
+	for j, consistent := range res.ConsistentPos {
+		if !consistent {
+			t.Errorf("site %d is inconsistent with weight %v", j+1, res.Weight[j])
+		}
+	}
+
+	// Requiring more than the template is the same as requiring all strategies.
+	opts.MinWeight = 3
+	if res, err = conspos.Run(context.Background(), input, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.ConsistentPos, unweighted.ConsistentPos) {
+		t.Errorf("consistent sites with a minimum weight of 3 differ from those of all strategies")
+	}
+
+	// Residue pairs count in proportion to the pairs reproduced.
+	opts.Metric = conspos.MetricPairs
+	if res, err = conspos.Run(context.Background(), input, opts); err != nil {
+		t.Fatal(err)
+	}
+	for j, weight := range res.Weight {
+		if weight < 2 || weight > 4 {
+			t.Errorf("site %d: weight = %v, want between 2 and 4", j+1, weight)
+		}
+	}
+}
+
+func TestWeightsCheck(t *testing.T) {
+	w := conspos.Weights{"einsi": 2, conspos.ReversePrefix + "ginsi": 0.5}
+	if err := w.Check([]string{"einsi", "ginsi", "linsi", conspos.ReversePrefix + "ginsi"}); err != nil {
+		t.Errorf("Check returned %v for weights of listed strategies", err)
+	}
+	if err := w.Check([]string{"einsi", "ginsi", "linsi"}); err == nil {
+		t.Error("Check accepted the weight of a reversed strategy that is not listed")
+	}
+	if err := (conspos.Weights{"einis": 2}).Check([]string{"einsi", "ginsi", "linsi"}); err == nil || !strings.Contains(err.Error(), "einis") {
+		t.Errorf("Check error = %v, want the misspelled strategy", err)
+	}
+}